@@ -0,0 +1,171 @@
+package client
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding - encodings requested and decompressed by the client
+const acceptEncoding = "gzip, deflate, br"
+
+// ErrResponseTooLarge - returned when the body exceeds the max response size
+var ErrResponseTooLarge = errors.New("http client response too large")
+
+// SetMaxResponseSize - limits the bytes read from a response body after
+// decompression, 0 is unlimited
+func (c *Client) SetMaxResponseSize(size int64) {
+	c.maxResponseSize = size
+}
+
+// SetStatusErrors - turns non 2xx responses into a *StatusError carrying the body
+func (c *Client) SetStatusErrors(enabled bool) {
+	c.statusErrors = enabled
+}
+
+// Stream - http call returning the body unread, see Request.Stream
+func (c Client) Stream(ctx context.Context, method string, url string, data []byte, hdr map[string]string) Res {
+	return c.shortcut(method, url, data, hdr).Stream(ctx)
+}
+
+// statusError replaces the result of non 2xx responses with a *StatusError
+func (c Client) statusError(res *Res) {
+	if !c.statusErrors || success(res.Response.StatusCode) {
+		return
+	}
+	if res.Error != nil && !res.buffered {
+		// the body could not be read
+		return
+	}
+	res.Error = &StatusError{
+		StatusCode: res.Response.StatusCode,
+		Status:     res.Response.Status,
+		Header:     res.Response.Header,
+		Body:       res.body,
+	}
+}
+
+func success(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// wrapBody decompresses the body when the client asked for compression and
+// enforces the max response size
+func (c Client) wrapBody(resp *http.Response, decompress bool) error {
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+		return nil
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if decompress && !resp.Uncompressed && encoding != "" && encoding != "identity" {
+		body, e := decompressor(encoding, resp.Body)
+		if e != nil {
+			resp.Body.Close()
+			return e
+		}
+		if body != nil {
+			resp.Body = body
+			resp.Header.Del("Content-Encoding")
+			resp.Header.Del("Content-Length")
+			resp.ContentLength = -1
+			resp.Uncompressed = true
+		}
+	}
+	if c.maxResponseSize > 0 {
+		if resp.ContentLength > c.maxResponseSize {
+			resp.Body.Close()
+			return ErrResponseTooLarge
+		}
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: c.maxResponseSize}
+	}
+	return nil
+}
+
+// decompressor wraps body according to the encoding, unknown encodings return nil
+func decompressor(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		r, e := gzip.NewReader(body)
+		if e != nil {
+			return nil, e
+		}
+		return &decompressedBody{Reader: r, body: body, closer: r}, nil
+	case "deflate":
+		// deflate should be zlib wrapped but some servers send raw deflate
+		buf := bufio.NewReader(body)
+		header, e := buf.Peek(2)
+		if e != nil && e != io.EOF {
+			return nil, e
+		}
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			r, e := zlib.NewReader(buf)
+			if e != nil {
+				return nil, e
+			}
+			return &decompressedBody{Reader: r, body: body, closer: r}, nil
+		}
+		r := flate.NewReader(buf)
+		return &decompressedBody{Reader: r, body: body, closer: r}, nil
+	case "br":
+		return &decompressedBody{Reader: brotli.NewReader(body), body: body}, nil
+	}
+	return nil, nil
+}
+
+// decompressedBody closes the decompressor and the underlying body
+type decompressedBody struct {
+	io.Reader
+	body   io.Closer
+	closer io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	if b.closer != nil {
+		b.closer.Close()
+	}
+	return b.body.Close()
+}
+
+// limitedBody fails with ErrResponseTooLarge instead of truncating silently
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// probe for more data to tell an exact fit from an oversized body
+		var probe [1]byte
+		n, e := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+		return 0, e
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, e := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, e
+}
+
+// cancelBody releases the request context once the caller is done with the body
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	e := b.ReadCloser.Close()
+	b.cancel()
+	return e
+}
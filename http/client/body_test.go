@@ -0,0 +1,236 @@
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestDecompression(t *testing.T) {
+	payload := `{"message":"compressed"}`
+	writers := map[string]func(io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		"raw": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.URL.Query().Get("encoding")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "br") {
+			w.Write([]byte(payload))
+			return
+		}
+		header := encoding
+		if encoding == "raw" {
+			header = "deflate"
+		}
+		w.Header().Set("Content-Encoding", header)
+		zw := writers[encoding](w)
+		zw.Write([]byte(payload))
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	for encoding := range writers {
+		res := c.Get(context.Background(), srv.URL+"?encoding="+encoding, nil, nil)
+		if res.Error != nil || string(res.JSON) != payload {
+			t.Errorf("%s: expected decompressed body, got %v %s", encoding, res.Error, res.JSON)
+		}
+		if res.Response.Header.Get("Content-Encoding") != "" {
+			t.Errorf("%s: expected Content-Encoding to be removed", encoding)
+		}
+	}
+
+	// an explicit Accept-Encoding gets the body as is
+	res := c.Get(context.Background(), srv.URL+"?encoding=gzip", nil, map[string]string{"Accept-Encoding": "gzip, br"})
+	if raw, _ := res.Bytes(); bytes.Equal(raw, []byte(payload)) || res.Response.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("Expected body to stay compressed")
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("chunked") != "" {
+			w.Write([]byte(`"`))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(`"0123456789"`)[1:])
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"), WithMaxResponseSize(8))
+	for _, u := range []string{srv.URL, srv.URL + "?chunked=1"} {
+		if res := c.Get(context.Background(), u, nil, nil); !errors.Is(res.Error, ErrResponseTooLarge) {
+			t.Errorf("%s: expected ErrResponseTooLarge, got %v", u, res.Error)
+		}
+	}
+	c.SetMaxResponseSize(12)
+	if res := c.Get(context.Background(), srv.URL+"?chunked=1", nil, nil); res.Error != nil {
+		t.Fatalf("Expected body of exactly the max size to pass, got %v", res.Error)
+	}
+}
+
+type item struct {
+	ID   int    `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+func TestDecode(t *testing.T) {
+	bodies := map[string][2]string{
+		"json": {"application/json; charset=utf-8", `{"id":1,"name":"json"}`},
+		"xml":  {"application/xml", `<item><id>2</id><name>xml</name></item>`},
+		"form": {"application/x-www-form-urlencoded", `id=3&name=form`},
+		"text": {"text/plain", `plain`},
+		"html": {"text/html", `<p>not json</p>`},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := bodies[strings.TrimPrefix(r.URL.Path, "/")]
+		w.Header().Set("Content-Type", body[0])
+		w.Write([]byte(body[1]))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	var v item
+	res := c.Get(context.Background(), srv.URL+"/json", nil, nil)
+	if e := res.Decode(&v); e != nil || v.ID != 1 || v.Name != "json" {
+		t.Fatalf("Unexpected json decode %v %+v", e, v)
+	}
+	// decode still works when JSONparse failed on a non json body
+	res = c.Get(context.Background(), srv.URL+"/xml", nil, nil)
+	if res.Error == nil {
+		t.Fatal("Expected JSONparse error on xml body")
+	}
+	if e := res.Decode(&v); e != nil || v.ID != 2 || v.Name != "xml" {
+		t.Fatalf("Unexpected xml decode %v %+v", e, v)
+	}
+	var form url.Values
+	res = c.Get(context.Background(), srv.URL+"/form", nil, nil)
+	if e := res.Decode(&form); e != nil || form.Get("name") != "form" {
+		t.Fatalf("Unexpected form decode %v %v", e, form)
+	}
+	var text string
+	res = c.Get(context.Background(), srv.URL+"/text", nil, nil)
+	if e := res.Decode(&text); e != nil || text != "plain" {
+		t.Fatalf("Unexpected text decode %v %s", e, text)
+	}
+	if e := res.Decode(&v); e == nil {
+		t.Fatal("Expected error decoding text into a struct")
+	}
+	var raw []byte
+	res = c.Get(context.Background(), srv.URL+"/html", nil, nil)
+	if e := res.Decode(&raw); e != nil || string(raw) != `<p>not json</p>` {
+		t.Fatalf("Unexpected raw decode %v %s", e, raw)
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "{\"id\":%d,\"name\":\"item%d\"}\r\n", i, i)
+			if i == 2 {
+				w.Write([]byte("\n"))
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	res := c.Stream(context.Background(), "GET", srv.URL, nil, nil)
+	if res.Error != nil || res.JSON != nil {
+		t.Fatalf("Expected unread stream, got %v %s", res.Error, res.JSON)
+	}
+	var items []item
+	e := res.NDJSON(func(value json.RawMessage) error {
+		var v item
+		if e := json.Unmarshal(value, &v); e != nil {
+			return e
+		}
+		items = append(items, v)
+		return nil
+	})
+	if e != nil || len(items) != 3 || items[2].Name != "item3" {
+		t.Fatalf("Unexpected ndjson items %v %+v", e, items)
+	}
+
+	// stopping early closes the body
+	res = c.Stream(context.Background(), "GET", srv.URL, nil, nil)
+	stop := errors.New("stop")
+	lines := 0
+	e = res.Lines(func(line []byte) error {
+		lines++
+		if bytes.HasSuffix(line, []byte("\r")) {
+			t.Error("Expected line ending to be trimmed")
+		}
+		return stop
+	})
+	if e != stop || lines != 1 {
+		t.Fatalf("Expected iteration to stop, got %v after %d lines", e, lines)
+	}
+	if _, e := res.Response.Body.Read(make([]byte, 1)); e == nil {
+		t.Fatal("Expected body to be closed")
+	}
+
+	// streams are not cut by the client timeout once overridden
+	c.SetTimeout(10)
+	res = c.Stream(OverrideTimeout(context.Background(), 0), "GET", srv.URL, nil, nil)
+	time.Sleep(20 * time.Millisecond)
+	var all []byte
+	if e := res.Decode(&all); e != nil || bytes.Count(all, []byte("\n")) != 4 {
+		t.Fatalf("Unexpected stream body %v %s", e, all)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"order not found"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	if res := c.Get(context.Background(), srv.URL, nil, nil); res.Error != nil {
+		t.Fatalf("Expected no error without status errors, got %v", res.Error)
+	}
+
+	c.SetStatusErrors(true)
+	for _, res := range []Res{
+		c.Get(context.Background(), srv.URL, nil, nil),
+		c.Stream(context.Background(), "GET", srv.URL, nil, nil),
+	} {
+		var se *StatusError
+		if !errors.As(res.Error, &se) || se.StatusCode != http.StatusNotFound {
+			t.Fatalf("Expected StatusError, got %v", res.Error)
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if e := se.Decode(&body); e != nil || body.Error != "order not found" {
+			t.Fatalf("Unexpected error body %v %+v", e, body)
+		}
+		if e := res.Decode(&body); e != res.Error || res.Close() != nil {
+			t.Fatalf("Expected Decode to return the status error, got %v", e)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BreakerState - state of the circuit breaker of a host
+type BreakerState int
+
+// circuit breaker states
+const (
+	// StateClosed - requests flow normally while failures are counted
+	StateClosed BreakerState = iota
+	// StateOpen - requests fail fast with ErrCircuitOpen until the cool-down ends
+	StateOpen
+	// StateHalfOpen - a limited number of trial requests decide whether to close again
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen - matches every CircuitOpenError with errors.Is
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError - returned without calling the host while its circuit is open
+type CircuitOpenError struct {
+	Host string
+	// RetryAt - when the next trial request will be let through
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open for %s until %s", e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+// Is - makes errors.Is(e, ErrCircuitOpen) true
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerOptions - options of the per host circuit breaker
+type BreakerOptions struct {
+	// FailureRatio - ratio of failed requests within the window opening the circuit, defaults to 0.5
+	FailureRatio float64
+	// MinRequests - requests needed within the window before the ratio applies, defaults to 10
+	MinRequests int
+	// Window - period over which requests are counted while closed, defaults to 10s
+	Window time.Duration
+	// CoolDown - how long the circuit stays open before trial requests, defaults to 30s
+	CoolDown time.Duration
+	// HalfOpenRequests - trial requests that must all succeed to close the circuit, defaults to 1
+	HalfOpenRequests int
+	// IsFailure - classifies an attempt, defaults to transport errors and 5xx responses
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange - called on every transition, e.g. to export metrics
+	OnStateChange func(host string, from BreakerState, to BreakerState)
+}
+
+// BreakerStats - snapshot of the circuit breaker of a host
+type BreakerStats struct {
+	State BreakerState
+	// Requests and Failures - counted within the current window
+	Requests int
+	Failures int
+	// Opened - number of times the circuit opened
+	Opened int
+}
+
+// SetBreaker - enables a circuit breaker per upstream host, every attempt of
+// the retry policy goes through it and retries stop once the circuit opens
+func (c *Client) SetBreaker(opts BreakerOptions) {
+	if opts.FailureRatio <= 0 {
+		opts.FailureRatio = 0.5
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 10
+	}
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Second
+	}
+	if opts.CoolDown <= 0 {
+		opts.CoolDown = 30 * time.Second
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode >= http.StatusInternalServerError
+		}
+	}
+	c.breakers = &breakers{opts: opts, hosts: map[string]*breaker{}}
+}
+
+// BreakerStats - returns the circuit breaker snapshot of a host as written in the
+// request urls, e.g. api.example.com or localhost:8080
+func (c Client) BreakerStats(host string) BreakerStats {
+	if c.breakers == nil {
+		return BreakerStats{}
+	}
+	c.breakers.mu.Lock()
+	defer c.breakers.mu.Unlock()
+	b := c.breakers.hosts[host]
+	if b == nil {
+		return BreakerStats{}
+	}
+	return BreakerStats{State: b.state, Requests: b.requests, Failures: b.failures, Opened: b.opened}
+}
+
+type breakers struct {
+	opts  BreakerOptions
+	mu    sync.Mutex
+	hosts map[string]*breaker
+}
+
+type breaker struct {
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trials      int
+	successes   int
+	opened      int
+	// halfOpens - counts the moves to half-open so trials of a previous one
+	// are told apart
+	halfOpens int
+}
+
+// admission - how a request was let through, recorded with its outcome
+type admission struct {
+	trial     bool
+	halfOpens int
+}
+
+type transition struct {
+	host     string
+	from, to BreakerState
+}
+
+// allow admits a request to host or returns a CircuitOpenError
+func (s *breakers) allow(host string) (a admission, t *transition, e error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.hosts[host]
+	if b == nil {
+		b = &breaker{windowStart: time.Now()}
+		s.hosts[host] = b
+	}
+	now := time.Now()
+	switch b.state {
+	case StateClosed:
+		if now.Sub(b.windowStart) >= s.opts.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		return a, nil, nil
+	case StateOpen:
+		retryAt := b.openedAt.Add(s.opts.CoolDown)
+		if now.Before(retryAt) {
+			return a, nil, &CircuitOpenError{Host: host, RetryAt: retryAt}
+		}
+		t = b.move(host, StateHalfOpen)
+	}
+	if b.trials >= s.opts.HalfOpenRequests {
+		return a, t, &CircuitOpenError{Host: host, RetryAt: now}
+	}
+	b.trials++
+	return admission{trial: true, halfOpens: b.halfOpens}, t, nil
+}
+
+// record reports the outcome of an admitted request, ignored outcomes such as
+// cancellations by the caller only free the trial slot. While half-open only
+// the trials of the current half-open state count, requests admitted before
+// are ignored
+func (s *breakers) record(host string, a admission, resp *http.Response, err error, ignore bool) (t *transition) {
+	failure := !ignore && s.opts.IsFailure(resp, err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.hosts[host]
+	if b == nil {
+		return nil
+	}
+	switch b.state {
+	case StateClosed:
+		if ignore {
+			return nil
+		}
+		b.requests++
+		if failure {
+			b.failures++
+		}
+		if b.requests >= s.opts.MinRequests && float64(b.failures)/float64(b.requests) >= s.opts.FailureRatio {
+			t = b.move(host, StateOpen)
+		}
+	case StateHalfOpen:
+		if !a.trial || a.halfOpens != b.halfOpens {
+			return nil
+		}
+		b.trials--
+		if ignore {
+			return nil
+		}
+		if failure {
+			return b.move(host, StateOpen)
+		}
+		b.successes++
+		if b.successes >= s.opts.HalfOpenRequests {
+			t = b.move(host, StateClosed)
+		}
+	}
+	return t
+}
+
+func (b *breaker) move(host string, to BreakerState) *transition {
+	t := &transition{host: host, from: b.state, to: to}
+	b.state = to
+	b.trials, b.successes = 0, 0
+	now := time.Now()
+	switch to {
+	case StateOpen:
+		b.openedAt = now
+		b.opened++
+	case StateHalfOpen:
+		b.halfOpens++
+	case StateClosed:
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	return t
+}
+
+// notify logs a transition and calls the hook, outside the breaker lock so
+// hooks may query BreakerStats
+func (c Client) notify(t *transition) {
+	if t == nil {
+		return
+	}
+	c.log.Out("HTTPC_BREAKER", fmt.Sprintf("%s %s -> %s", t.host, t.from, t.to))
+	if c.breakers.opts.OnStateChange != nil {
+		c.breakers.opts.OnStateChange(t.host, t.from, t.to)
+	}
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	var healthy int32
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	var mu sync.Mutex
+	var transitions []string
+	c, _ := New()
+	c.SetLogger("empty")
+	c.SetBreaker(BreakerOptions{
+		MinRequests: 4,
+		CoolDown:    50 * time.Millisecond,
+		OnStateChange: func(host string, from BreakerState, to BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			if host != u.Host {
+				t.Errorf("Unexpected host %s", host)
+			}
+			transitions = append(transitions, from.String()+">"+to.String())
+		},
+	})
+
+	for i := 0; i < 4; i++ {
+		c.Get(context.Background(), srv.URL, nil, nil)
+	}
+	if s := c.BreakerStats(u.Host); s.State != StateOpen || s.Opened != 1 {
+		t.Fatalf("Expected circuit to open, got %+v", s)
+	}
+	res := c.Get(context.Background(), srv.URL, nil, nil)
+	var open *CircuitOpenError
+	if !errors.Is(res.Error, ErrCircuitOpen) || !errors.As(res.Error, &open) || open.Host != u.Host {
+		t.Fatalf("Expected CircuitOpenError, got %v", res.Error)
+	}
+	if calls != 4 {
+		t.Fatalf("Expected open circuit to fail fast, got %d calls", calls)
+	}
+
+	// a failed trial opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	c.Get(context.Background(), srv.URL, nil, nil)
+	if s := c.BreakerStats(u.Host); s.State != StateOpen || s.Opened != 2 {
+		t.Fatalf("Expected failed trial to reopen the circuit, got %+v", s)
+	}
+
+	// a successful trial closes it
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(60 * time.Millisecond)
+	res = c.Get(context.Background(), srv.URL, nil, nil)
+	if res.Error != nil || c.BreakerStats(u.Host).State != StateClosed {
+		t.Fatalf("Expected successful trial to close the circuit, got %v", res.Error)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expect := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if len(transitions) != len(expect) {
+		t.Fatalf("Expected transitions %v, got %v", expect, transitions)
+	}
+	for i := range expect {
+		if transitions[i] != expect[i] {
+			t.Fatalf("Expected transitions %v, got %v", expect, transitions)
+		}
+	}
+}
+
+func TestBreakerWithRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, _ := New()
+	c.SetLogger("empty")
+	c.SetRetry(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond})
+	c.SetBreaker(BreakerOptions{MinRequests: 2, FailureRatio: 1})
+	res := c.Get(context.Background(), srv.URL, nil, nil)
+	if !errors.Is(res.Error, ErrCircuitOpen) {
+		t.Fatalf("Expected retries to stop on open circuit, got %v", res.Error)
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 calls before the circuit opened, got %d", calls)
+	}
+}
+
+func TestBreakerTrials(t *testing.T) {
+	var c Client
+	c.SetBreaker(BreakerOptions{MinRequests: 1, CoolDown: time.Millisecond})
+	b := c.breakers
+	ok := &http.Response{StatusCode: http.StatusOK}
+	fail := &http.Response{StatusCode: http.StatusBadGateway}
+
+	// a slow request admitted while closed outlives the open state
+	slow, _, _ := b.allow("api")
+	failed, _, _ := b.allow("api")
+	b.record("api", failed, fail, nil, false)
+	time.Sleep(2 * time.Millisecond)
+	trial, _, e := b.allow("api")
+	if e != nil || !trial.trial {
+		t.Fatalf("Expected a trial after the cool-down, got %v", e)
+	}
+	// its outcome neither frees the trial slot nor closes the circuit
+	b.record("api", slow, ok, nil, false)
+	if _, _, e := b.allow("api"); !errors.Is(e, ErrCircuitOpen) {
+		t.Fatalf("Expected a single trial, got %v", e)
+	}
+	if s := c.BreakerStats("api"); s.State != StateHalfOpen {
+		t.Fatalf("Expected the circuit to stay half-open, got %s", s.State)
+	}
+	b.record("api", trial, ok, nil, false)
+	if s := c.BreakerStats("api"); s.State != StateClosed {
+		t.Fatalf("Expected the trial to close the circuit, got %s", s.State)
+	}
+}
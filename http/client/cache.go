@@ -0,0 +1,519 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStatus - how a response was served, see Res.Cache
+type CacheStatus string
+
+// cache statuses, empty when the cache was not involved
+const (
+	// CacheMiss - served by the upstream, and stored when cacheable
+	CacheMiss CacheStatus = "MISS"
+	// CacheHit - served from the cache without contacting the upstream
+	CacheHit CacheStatus = "HIT"
+	// CacheRevalidated - served from the cache after the upstream answered 304
+	CacheRevalidated CacheStatus = "REVALIDATED"
+	// CacheStale - served stale, either while revalidating in the background
+	// (stale-while-revalidate) or because the upstream failed (stale-if-error)
+	CacheStale CacheStatus = "STALE"
+)
+
+// CacheOptions - options of the response cache
+type CacheOptions struct {
+	// Store - defaults to a 64MB MemoryCache
+	Store CacheStore
+	// Shared - behave as a shared cache: honour s-maxage, skip private
+	// responses and responses to authorized requests unless marked public.
+	// Private caches keep the responses of each Authorization apart
+	Shared bool
+	// MaxEntrySize - larger bodies are not cached, defaults to 1MB
+	MaxEntrySize int64
+	// KeepStale - how long stale responses with a validator are kept for
+	// revalidation, defaults to 24h
+	KeepStale time.Duration
+	// Prefix - prefix of the store keys, defaults to "httpc:"
+	Prefix string
+}
+
+// httpCache implements the caching of RFC 9111 for GET requests
+type httpCache struct {
+	opts    CacheOptions
+	pending sync.Map
+}
+
+// SetCache - enables the response cache, see CacheOptions
+func (c *Client) SetCache(opts CacheOptions) {
+	if opts.Store == nil {
+		opts.Store = NewMemoryCache(0)
+	}
+	if opts.MaxEntrySize <= 0 {
+		opts.MaxEntrySize = 1 << 20
+	}
+	if opts.KeepStale <= 0 {
+		opts.KeepStale = 24 * time.Hour
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "httpc:"
+	}
+	c.cache = &httpCache{opts: opts}
+}
+
+// WithCache - enables the response cache, see SetCache
+func WithCache(opts CacheOptions) Option {
+	return func(cfg *config) error {
+		cfg.cache = &opts
+		return nil
+	}
+}
+
+// cacheEntry - stored response
+type cacheEntry struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	Request  time.Time   `json:"request_time"`
+	Response time.Time   `json:"response_time"`
+}
+
+// cacheControl - directives of Cache-Control headers, lower case
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			k, val := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				k, val = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(k))] = val
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the delta-seconds of the directive
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, e := strconv.ParseInt(v, 10, 64)
+	if e != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// statuses cacheable without explicit freshness, RFC 9110 15.1
+var heuristicStatuses = map[int]bool{200: true, 203: true, 204: true, 300: true, 301: true, 308: true, 404: true, 405: true, 410: true, 414: true, 501: true}
+
+// do serves GET requests from the cache, other methods go to the upstream and
+// invalidate the cached url on success
+func (hc *httpCache) do(c Client, req *http.Request) (*http.Response, CacheStatus, error) {
+	ctx := req.Context()
+	if req.Method != http.MethodGet {
+		resp, e := c.do(req)
+		if e == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && resp.StatusCode < 400 {
+			// unsafe methods invalidate, RFC 9111 4.4
+			hc.opts.Store.Del(ctx, hc.indexKey(req.URL))
+		}
+		return resp, "", e
+	}
+	reqCC := parseCacheControl(req.Header)
+	if !reqCC.has("no-cache") && req.Header.Get("Pragma") == "no-cache" && len(req.Header.Values("Cache-Control")) == 0 {
+		reqCC["no-cache"] = ""
+	}
+	if reqCC.has("no-store") {
+		resp, e := c.do(req)
+		return resp, "", e
+	}
+
+	key, entry := hc.lookup(c, req)
+	if entry == nil {
+		if reqCC.has("only-if-cached") {
+			return gatewayTimeout(req), CacheMiss, nil
+		}
+		return hc.fetch(c, req, nil)
+	}
+
+	now := time.Now()
+	resCC := parseCacheControl(entry.Header)
+	age := entry.age(now)
+	lifetime := entry.lifetime(hc.opts.Shared, resCC)
+	fresh := age < lifetime && !resCC.has("no-cache") && !reqCC.has("no-cache")
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		fresh = false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && lifetime-age < minFresh {
+		fresh = false
+	}
+	if fresh {
+		return entry.response(req, age), CacheHit, nil
+	}
+
+	stale := age - lifetime
+	revalidate := resCC.has("must-revalidate") || (hc.opts.Shared && resCC.has("proxy-revalidate")) || resCC.has("no-cache")
+	if !revalidate && !reqCC.has("no-cache") {
+		if v, ok := reqCC["max-stale"]; ok {
+			maxStale, valid := reqCC.seconds("max-stale")
+			if v == "" || (valid && stale <= maxStale) {
+				return entry.response(req, age), CacheStale, nil
+			}
+		}
+		if swr, ok := resCC.seconds("stale-while-revalidate"); ok && stale <= swr {
+			hc.background(c, req, key, entry)
+			return entry.response(req, age), CacheStale, nil
+		}
+	}
+	if reqCC.has("only-if-cached") {
+		return gatewayTimeout(req), CacheMiss, nil
+	}
+	return hc.fetch(c, req, entry)
+}
+
+// fetch calls the upstream, conditionally when entry has validators, and
+// stores the response when cacheable
+func (hc *httpCache) fetch(c Client, req *http.Request, entry *cacheEntry) (*http.Response, CacheStatus, error) {
+	out := req
+	if entry != nil {
+		etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			out = req.Clone(req.Context())
+			if etag != "" {
+				out.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				out.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+	requested := time.Now()
+	resp, e := c.do(out)
+	if entry != nil && (e != nil || resp.StatusCode >= 500) && hc.staleIfError(req, entry) {
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		return entry.response(req, entry.age(time.Now())), CacheStale, nil
+	}
+	if e != nil {
+		return nil, "", e
+	}
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		// the 304 updates the stored headers, RFC 9111 4.3.4
+		for k, vs := range resp.Header {
+			if k != "Content-Length" {
+				entry.Header[k] = vs
+			}
+		}
+		entry.Request, entry.Response = requested, time.Now()
+		hc.store(c, req, entry)
+		return entry.response(req, entry.age(time.Now())), CacheRevalidated, nil
+	}
+	return hc.save(c, req, resp, requested), CacheMiss, nil
+}
+
+// staleIfError tells whether entry may be served because the upstream failed
+func (hc *httpCache) staleIfError(req *http.Request, entry *cacheEntry) bool {
+	resCC := parseCacheControl(entry.Header)
+	if resCC.has("must-revalidate") || resCC.has("no-cache") {
+		return false
+	}
+	now := time.Now()
+	stale := entry.age(now) - entry.lifetime(hc.opts.Shared, resCC)
+	for _, cc := range []cacheControl{parseCacheControl(req.Header), resCC} {
+		if sie, ok := cc.seconds("stale-if-error"); ok && stale <= sie {
+			return true
+		}
+	}
+	return false
+}
+
+// background revalidates entry once, whatever the number of callers
+func (hc *httpCache) background(c Client, req *http.Request, key string, entry *cacheEntry) {
+	if _, running := hc.pending.LoadOrStore(key, true); running {
+		return
+	}
+	ctx, cancel := c.withTimeout(context.Background())
+	bg := req.Clone(ctx)
+	go func() {
+		defer cancel()
+		defer hc.pending.Delete(key)
+		resp, _, e := hc.fetch(c, bg, entry)
+		if e != nil {
+			c.log.Error("HTTPC_CACHE", e)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// save reads the body of a cacheable response and stores it, the response
+// is returned with a body the caller can read
+func (hc *httpCache) save(c Client, req *http.Request, resp *http.Response, requested time.Time) *http.Response {
+	if !hc.storable(req, resp) {
+		return resp
+	}
+	data, e := io.ReadAll(io.LimitReader(resp.Body, hc.opts.MaxEntrySize+1))
+	if e != nil || int64(len(data)) > hc.opts.MaxEntrySize {
+		// too large to cache, hand over what was read followed by the rest
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		return resp
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	hc.store(c, req, &cacheEntry{
+		Status:   resp.StatusCode,
+		Header:   resp.Header.Clone(),
+		Body:     data,
+		Request:  requested,
+		Response: time.Now(),
+	})
+	return resp
+}
+
+// storable tells whether the response may be stored, RFC 9111 3
+func (hc *httpCache) storable(req *http.Request, resp *http.Response) bool {
+	if resp.StatusCode < 200 || resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	if parseCacheControl(req.Header).has("no-store") {
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") {
+		return false
+	}
+	for _, v := range resp.Header.Values("Vary") {
+		if strings.TrimSpace(v) == "*" {
+			return false
+		}
+	}
+	if hc.opts.Shared {
+		if cc.has("private") {
+			return false
+		}
+		if req.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+			return false
+		}
+	}
+	_, maxAge := cc.seconds("max-age")
+	_, sMaxAge := cc.seconds("s-maxage")
+	explicit := maxAge || (hc.opts.Shared && sMaxAge) || resp.Header.Get("Expires") != ""
+	validator := resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+	return explicit || cc.has("public") || validator || heuristicStatuses[resp.StatusCode]
+}
+
+// lookup returns the key and stored entry matching the request, nil if none
+func (hc *httpCache) lookup(c Client, req *http.Request) (string, *cacheEntry) {
+	ctx := req.Context()
+	raw, e := hc.opts.Store.Get(ctx, hc.indexKey(req.URL))
+	if e != nil {
+		c.log.Error("HTTPC_CACHE", e)
+		return "", nil
+	}
+	if raw == "" {
+		return "", nil
+	}
+	var vary []string
+	if json.Unmarshal([]byte(raw), &vary) != nil {
+		return "", nil
+	}
+	key := hc.entryKey(req, vary)
+	raw, e = hc.opts.Store.Get(ctx, key)
+	if e != nil {
+		c.log.Error("HTTPC_CACHE", e)
+		return key, nil
+	}
+	if raw == "" {
+		return key, nil
+	}
+	var entry cacheEntry
+	if json.Unmarshal([]byte(raw), &entry) != nil {
+		return key, nil
+	}
+	return key, &entry
+}
+
+// store saves the entry under its vary key and the vary header names under the url
+func (hc *httpCache) store(c Client, req *http.Request, entry *cacheEntry) {
+	ctx := req.Context()
+	var vary []string
+	for _, v := range entry.Header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vary)
+	cc := parseCacheControl(entry.Header)
+	ttl := entry.lifetime(hc.opts.Shared, cc) - entry.age(entry.Response)
+	var window time.Duration
+	for _, directive := range []string{"stale-while-revalidate", "stale-if-error"} {
+		if d, ok := cc.seconds(directive); ok && d > window {
+			window = d
+		}
+	}
+	ttl += window
+	if entry.Header.Get("ETag") != "" || entry.Header.Get("Last-Modified") != "" {
+		ttl += hc.opts.KeepStale
+	}
+	if ttl < time.Second {
+		// nothing worth keeping
+		return
+	}
+	data, e := json.Marshal(entry)
+	if e != nil {
+		return
+	}
+	index, _ := json.Marshal(vary)
+	if _, e := hc.opts.Store.Set(ctx, hc.entryKey(req, vary), string(data), ttl); e != nil {
+		c.log.Error("HTTPC_CACHE", e)
+		return
+	}
+	if _, e := hc.opts.Store.Set(ctx, hc.indexKey(req.URL), string(index), ttl); e != nil {
+		c.log.Error("HTTPC_CACHE", e)
+	}
+}
+
+func (hc *httpCache) indexKey(u *url.URL) string {
+	return hc.opts.Prefix + "v:" + u.String()
+}
+
+// entryKey includes the request values of the headers the response varies on,
+// and the credentials of the request for private caches. Credentials are hashed
+// so they never end up in the store
+func (hc *httpCache) entryKey(req *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(hc.opts.Prefix + "e:" + req.URL.String())
+	varyAuth := false
+	for _, name := range vary {
+		if strings.EqualFold(name, "Authorization") {
+			varyAuth = true
+			continue
+		}
+		b.WriteString("\n" + name + ":" + strings.Join(req.Header.Values(name), ","))
+	}
+	if auth := req.Header.Get("Authorization"); auth != "" && (!hc.opts.Shared || varyAuth) {
+		sum := sha256.Sum256([]byte(auth))
+		b.WriteString("\nAuthorization:" + hex.EncodeToString(sum[:]))
+	}
+	return b.String()
+}
+
+// age - current age of the entry, RFC 9111 4.2.3
+func (entry *cacheEntry) age(now time.Time) time.Duration {
+	date := entry.date()
+	apparent := entry.Response.Sub(date)
+	if apparent < 0 {
+		apparent = 0
+	}
+	var ageValue time.Duration
+	if n, e := strconv.ParseInt(entry.Header.Get("Age"), 10, 64); e == nil && n > 0 {
+		ageValue = time.Duration(n) * time.Second
+	}
+	corrected := ageValue + entry.Response.Sub(entry.Request)
+	initial := apparent
+	if corrected > initial {
+		initial = corrected
+	}
+	return initial + now.Sub(entry.Response)
+}
+
+// lifetime - freshness lifetime of the entry, RFC 9111 4.2.1
+func (entry *cacheEntry) lifetime(shared bool, cc cacheControl) time.Duration {
+	if shared {
+		if d, ok := cc.seconds("s-maxage"); ok {
+			return d
+		}
+	}
+	if d, ok := cc.seconds("max-age"); ok {
+		return d
+	}
+	date := entry.date()
+	if expires := entry.Header.Get("Expires"); expires != "" {
+		t, e := http.ParseTime(expires)
+		if e != nil {
+			// invalid dates mean already expired
+			return 0
+		}
+		return t.Sub(date)
+	}
+	if !heuristicStatuses[entry.Status] && !cc.has("public") {
+		return 0
+	}
+	// heuristic freshness, 10% of the time since the last modification
+	if lm, e := http.ParseTime(entry.Header.Get("Last-Modified")); e == nil && date.After(lm) {
+		return date.Sub(lm) / 10
+	}
+	return 0
+}
+
+func (entry *cacheEntry) date() time.Time {
+	if t, e := http.ParseTime(entry.Header.Get("Date")); e == nil {
+		return t
+	}
+	return entry.Response
+}
+
+// response builds the response served from the cache
+func (entry *cacheEntry) response(req *http.Request, age time.Duration) *http.Response {
+	header := entry.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	return &http.Response{
+		Status:        strconv.Itoa(entry.Status) + " " + http.StatusText(entry.Status),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+// gatewayTimeout - answer to only-if-cached requests without a usable entry
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 " + http.StatusText(http.StatusGatewayTimeout),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
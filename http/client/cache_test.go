@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheFreshness(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/short":
+			w.Header().Set("Cache-Control", "max-age=1")
+		case "/private":
+			w.Header().Set("Cache-Control", "no-store")
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"call":%d}`, n)
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"), WithCache(CacheOptions{}))
+	first := c.Get(context.Background(), srv.URL, nil, nil)
+	second := c.Get(context.Background(), srv.URL, nil, nil)
+	if first.Cache != CacheMiss || second.Cache != CacheHit || string(second.JSON) != `{"call":1}` {
+		t.Fatalf("Expected cache hit, got %s %s %s", first.Cache, second.Cache, second.JSON)
+	}
+	if second.Response.Header.Get("Age") == "" || calls != 1 {
+		t.Fatalf("Expected Age header and a single call, got %v %d", second.Response.Header, calls)
+	}
+
+	// request directives bypass the stored response
+	res := c.Get(context.Background(), srv.URL, nil, map[string]string{"Cache-Control": "no-cache"})
+	if res.Cache != CacheMiss || calls != 2 {
+		t.Fatalf("Expected no-cache request to reach the server, got %s %d", res.Cache, calls)
+	}
+
+	c.Get(context.Background(), srv.URL+"/short", nil, nil)
+	time.Sleep(1100 * time.Millisecond)
+	if res := c.Get(context.Background(), srv.URL+"/short", nil, nil); res.Cache != CacheMiss || calls != 4 {
+		t.Fatalf("Expected expired response to be fetched again, got %s %d", res.Cache, calls)
+	}
+
+	c.Get(context.Background(), srv.URL+"/private", nil, nil)
+	if res := c.Get(context.Background(), srv.URL+"/private", nil, nil); res.Cache != CacheMiss || calls != 6 {
+		t.Fatalf("Expected no-store response not to be cached, got %s %d", res.Cache, calls)
+	}
+	if res := c.Get(context.Background(), srv.URL+"/missing", nil, map[string]string{"Cache-Control": "only-if-cached"}); res.Response.StatusCode != 504 {
+		t.Fatalf("Expected 504 for only-if-cached, got %d", res.Response.StatusCode)
+	}
+
+	// unsafe methods invalidate the url
+	c.Post(context.Background(), srv.URL, []byte(`{}`), nil)
+	if res := c.Get(context.Background(), srv.URL, nil, nil); res.Cache != CacheMiss {
+		t.Fatalf("Expected POST to invalidate the cached response, got %s", res.Cache)
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	var calls, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Vary", "Accept-Language")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"lang":%q}`, r.Header.Get("Accept-Language"))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"), WithCache(CacheOptions{}))
+	en := map[string]string{"Accept-Language": "en"}
+	c.Get(context.Background(), srv.URL, nil, en)
+	res := c.Get(context.Background(), srv.URL, nil, en)
+	if res.Cache != CacheRevalidated || string(res.JSON) != `{"lang":"en"}` || notModified != 1 {
+		t.Fatalf("Expected revalidation with 304, got %s %s %d", res.Cache, res.JSON, notModified)
+	}
+
+	// responses vary on the language
+	res = c.Get(context.Background(), srv.URL, nil, map[string]string{"Accept-Language": "fr"})
+	if res.Cache != CacheMiss || string(res.JSON) != `{"lang":"fr"}` {
+		t.Fatalf("Expected separate entry per language, got %s %s", res.Cache, res.JSON)
+	}
+	if res = c.Get(context.Background(), srv.URL, nil, en); string(res.JSON) != `{"lang":"en"}` {
+		t.Fatalf("Expected english entry to be kept, got %s", res.JSON)
+	}
+}
+
+func TestCacheStale(t *testing.T) {
+	var calls int32
+	var failing int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/swr" {
+			w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=1, stale-if-error=60")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"call":%d}`, n)
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"), WithCache(CacheOptions{}))
+	c.Get(context.Background(), srv.URL+"/swr", nil, nil)
+	c.Get(context.Background(), srv.URL+"/sie", nil, nil)
+	time.Sleep(1100 * time.Millisecond)
+
+	// stale response served while revalidating in the background
+	res := c.Get(context.Background(), srv.URL+"/swr", nil, nil)
+	if res.Cache != CacheStale || string(res.JSON) != `{"call":1}` {
+		t.Fatalf("Expected stale response, got %s %s", res.Cache, res.JSON)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if res := c.Get(context.Background(), srv.URL+"/swr", nil, nil); res.Cache != CacheHit || string(res.JSON) != `{"call":3}` {
+		t.Fatalf("Expected revalidated response, got %s %s", res.Cache, res.JSON)
+	}
+
+	// stale response served while the server fails
+	atomic.StoreInt32(&failing, 1)
+	res = c.Get(context.Background(), srv.URL+"/sie", nil, nil)
+	if res.Cache != CacheStale || string(res.JSON) != `{"call":2}` || res.Response.StatusCode != 200 {
+		t.Fatalf("Expected stale response on error, got %s %s %d", res.Cache, res.JSON, res.Response.StatusCode)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCache(15)
+	m.Set(ctx, "a", "12345", 0)
+	m.Set(ctx, "b", "12345", 0)
+	m.Get(ctx, "a")
+	m.Set(ctx, "c", "12345", 0)
+	if v, _ := m.Get(ctx, "b"); v != "" || m.Len() != 2 {
+		t.Fatalf("Expected least recently used entry to be evicted, got %q %d", v, m.Len())
+	}
+	if v, _ := m.Get(ctx, "a"); v != "12345" {
+		t.Fatalf("Expected recently used entry to be kept, got %q", v)
+	}
+	m.Set(ctx, "big", strings.Repeat("x", 20), 0)
+	if v, _ := m.Get(ctx, "big"); v != "" {
+		t.Fatal("Expected values larger than the cache not to be stored")
+	}
+	m.Set(ctx, "ttl", "1", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if v, _ := m.Get(ctx, "ttl"); v != "" {
+		t.Fatal("Expected entry to expire")
+	}
+	if n, _ := m.Del(ctx, "a"); n != 1 {
+		t.Fatalf("Expected one key removed, got %d", n)
+	}
+}
+
+func TestCacheAuthorization(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"auth":%q}`, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	store := NewMemoryCache(1 << 20)
+	c, _ := New(WithLogger("empty"), WithCache(CacheOptions{Store: store}))
+	alice := map[string]string{"Authorization": "Bearer alice"}
+	bob := map[string]string{"Authorization": "Bearer bob"}
+	c.Get(context.Background(), srv.URL, nil, alice)
+	if res := c.Get(context.Background(), srv.URL, nil, alice); res.Cache != CacheHit || string(res.JSON) != `{"auth":"Bearer alice"}` {
+		t.Fatalf("Expected cached response of the same user, got %s %s", res.Cache, res.JSON)
+	}
+	if res := c.Get(context.Background(), srv.URL, nil, bob); res.Cache != CacheMiss || string(res.JSON) != `{"auth":"Bearer bob"}` {
+		t.Fatalf("Expected response of another user not to be shared, got %s %s", res.Cache, res.JSON)
+	}
+	if res := c.Get(context.Background(), srv.URL, nil, nil); res.Cache != CacheMiss || calls != 3 {
+		t.Fatalf("Expected anonymous request not to get an authorized response, got %s %d", res.Cache, calls)
+	}
+	for key := range store.items {
+		if strings.Contains(key, "alice") {
+			t.Fatalf("Expected credentials to be hashed in the key, got %q", key)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// CacheStore - storage of the response cache, both MemoryCache and
+// github.com/kelchy/go-lib/redis Client satisfy it, the latter sharing the
+// cache across instances
+type CacheStore interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) (string, error)
+	Del(ctx context.Context, key string) (int64, error)
+}
+
+// MemoryCache - in-process CacheStore evicting the least recently used
+// entries once the size limit is reached
+type MemoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+// NewMemoryCache - creates a cache holding up to maxBytes of keys and values,
+// defaults to 64MB
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	return &MemoryCache{maxBytes: maxBytes, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get - returns the value of key, empty if missing or expired
+func (m *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.items[key]
+	if !ok {
+		return "", nil
+	}
+	item := elem.Value.(*memoryCacheItem)
+	if !item.expires.IsZero() && time.Now().After(item.expires) {
+		m.remove(elem)
+		return "", nil
+	}
+	m.ll.MoveToFront(elem)
+	return item.value, nil
+}
+
+// Set - stores value under key, a ttl of 0 never expires, values larger than
+// the cache are not stored
+func (m *MemoryCache) Set(ctx context.Context, key string, value string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.items[key]; ok {
+		m.remove(elem)
+	}
+	size := int64(len(key) + len(value))
+	if size > m.maxBytes {
+		return "OK", nil
+	}
+	item := &memoryCacheItem{key: key, value: value}
+	if ttl > 0 {
+		item.expires = time.Now().Add(ttl)
+	}
+	m.items[key] = m.ll.PushFront(item)
+	m.size += size
+	for m.size > m.maxBytes {
+		m.remove(m.ll.Back())
+	}
+	return "OK", nil
+}
+
+// Del - removes key, returns the number of keys removed
+func (m *MemoryCache) Del(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.items[key]
+	if !ok {
+		return 0, nil
+	}
+	m.remove(elem)
+	return 1, nil
+}
+
+// Len - number of entries, expired ones included until they are evicted
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ll.Len()
+}
+
+func (m *MemoryCache) remove(elem *list.Element) {
+	item := m.ll.Remove(elem).(*memoryCacheItem)
+	delete(m.items, item.key)
+	m.size -= int64(len(item.key) + len(item.value))
+}
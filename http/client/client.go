@@ -4,11 +4,8 @@ import (
 	"bytes"
 	"context"
 	"time"
-	"strings"
 	"net"
 	"net/http"
-	"crypto/tls"
-	"golang.org/x/net/http2"
 	"github.com/kelchy/go-lib/log"
 )
 
@@ -21,57 +18,75 @@ type Client struct {
 	timeout	int
 	log	log.Log
 	JSON	bool
+	retry	RetryPolicy
+	breakers	*breakers
+	dialer	*net.Dialer
+	transport	*http.Transport
+	transportCfg	*config
+	maxResponseSize	int64
+	statusErrors	bool
+	middlewares	[]namedMiddleware
+	cache	*httpCache
 }
 
-// New - creates an returns http client
-func New() (Client, error) {
+// New - creates an returns http client, without options the defaults are
+// tuned for production: pooled keep-alive connections, proxy from the
+// environment, tls 1.2 minimum and dial/tls timeouts
+func New(opts ...Option) (Client, error) {
 	var client Client
-	c := &http.Client{
-		Transport: &http.Transport{
-/*
-			CloseIdleConnections:
-			MaxIdleConnsPerHost:
-			DisableKeepAlives:
-*/
-		},
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		if e := opt(cfg); e != nil {
+			return client, e
+		}
+	}
+	c := &http.Client{}
+	if cfg.transport != nil {
+		c.Transport = cfg.transport
+	} else {
+		// kept so SetTimeouts can build a new transport from it
+		tcfg := *cfg
+		tr, dialer, e := tcfg.buildTransport()
+		if e != nil {
+			return client, e
+		}
+		c.Transport = tr
+		client.dialer, client.transport, client.transportCfg = dialer, tr, &tcfg
 	}
 	client.Client = c
-	client.timeout = TIMEOUT
-	l, e := log.New("")
+	client.timeout = int(cfg.timeouts.Request / time.Millisecond)
+	l, e := log.New(cfg.logType)
 	if e != nil {
 		return client, e
 	}
 	client.log = l
-	client.JSON = true
-	return client, nil
-}
-
-// NewHTTP2 - creates and returns http/2 client
-func NewHTTP2() (Client, error) {
-	var client Client
-	c := &http.Client{
-		Transport: &http2.Transport{
-			// So http2.Transport doesn't complain the URL scheme isn't 'https'
-			AllowHTTP: true,
-			// Pretend we are dialing a TLS endpoint.
-			// Note, we ignore the passed tls.Config
-			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-				// h2c
-				return net.Dial(network, addr)
-			},
-		},
+	client.JSON = cfg.json
+	client.maxResponseSize = cfg.maxResponseSize
+	client.statusErrors = cfg.statusErrors
+	if cfg.retry != nil {
+		client.SetRetry(*cfg.retry)
 	}
-	client.Client = c
-	client.timeout = TIMEOUT
-	l, e := log.New("")
-	client.log = l
-	if e != nil {
-		return client, e
+	if cfg.breaker != nil {
+		client.SetBreaker(*cfg.breaker)
+	}
+	for _, m := range cfg.middlewares {
+		client.Use(m.name, m.mw)
+	}
+	if cfg.cache != nil {
+		client.SetCache(*cfg.cache)
+	}
+	if cfg.oauth2 != nil {
+		ts, e := NewTokenSource(client, *cfg.oauth2)
+		if e != nil {
+			return client, e
+		}
+		client.Use(MiddlewareOAuth2, ts.Middleware())
 	}
 	return client, nil
 }
 
-// SetTimeout - changes the default timeout set on code
+// SetTimeout - changes the request timeout in milliseconds, it applies to every
+// call on top of the deadline of the context passed in
 func (c *Client) SetTimeout(timeout int) {
 	c.timeout = timeout
 }
@@ -91,63 +106,45 @@ func (c *Client) SetJSON(enabled bool) {
 
 // Get - http call using get method, timeout in milli
 func (c Client) Get(ctx context.Context, url string, data []byte, hdr map[string]string) Res {
-	return c.req(ctx, "GET", url, data, hdr)
+	return c.shortcut("GET", url, data, hdr).Do(ctx)
+}
+
+// Head - http call using head method, the body is not parsed
+func (c Client) Head(ctx context.Context, url string, hdr map[string]string) Res {
+	return c.shortcut("HEAD", url, nil, hdr).Do(ctx)
+}
+
+// Options - http call using options method, timeout in milli
+func (c Client) Options(ctx context.Context, url string, hdr map[string]string) Res {
+	return c.shortcut("OPTIONS", url, nil, hdr).Do(ctx)
 }
 
 // Post - http call using post method, timeout in milli
 func (c Client) Post(ctx context.Context, url string, data []byte, hdr map[string]string) Res {
-	return c.req(ctx, "POST", url, data, hdr)
+	return c.shortcut("POST", url, data, hdr).Do(ctx)
 }
 
 // Put - http call using put method, timeout in milli
 func (c Client) Put(ctx context.Context, url string, data []byte, hdr map[string]string) Res {
-	return c.req(ctx, "PUT", url, data, hdr)
+	return c.shortcut("PUT", url, data, hdr).Do(ctx)
 }
 
 // Patch - http call using patch method, timeout in milli
 func (c Client) Patch(ctx context.Context, url string, data []byte, hdr map[string]string) Res {
-	return c.req(ctx, "PATCH", url, data, hdr)
+	return c.shortcut("PATCH", url, data, hdr).Do(ctx)
 }
 
 // Delete - http call using delete method, timeout in milli
 func (c Client) Delete(ctx context.Context, url string, data []byte, hdr map[string]string) Res {
-	return c.req(ctx, "DELETE", url, data, hdr)
+	return c.shortcut("DELETE", url, data, hdr).Do(ctx)
 }
 
-func (c Client) req(ctx context.Context, method string, url string, data []byte, hdr map[string]string) Res {
-	var cancel context.CancelFunc
-	if ctx == nil {
-		timesec := c.timeout
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timesec) * time.Millisecond)
-		defer cancel()
-	}
-
-	var res Res
-	res.log = c.log
-	req, e := http.NewRequestWithContext(ctx, strings.ToUpper(method), url, bytes.NewBuffer(data))
-	if e != nil {
-		c.log.Error("HTTPC_NEW", e)
-		res.Error = e
-		return res
-	}
-
-	// default json for RESTful
-	req.Header.Set("Content-Type", "application/json")
-	for k, v := range hdr {
-		req.Header.Set(k, v)
-	}
-
-	resp, e := c.Client.Do(req)
-	if e != nil {
-		c.log.Error("HTTPC_DO", e)
-		res.Error = e
-		return res
-	}
-	res.Response = *resp
-	if c.JSON {
-		res.JSONparse()
-	} else {
-		res.HTMLparse()
+// shortcut builds the request of the method helpers, data is sent as json
+func (c Client) shortcut(method string, url string, data []byte, hdr map[string]string) *Request {
+	r := c.Request(method, url)
+	if len(data) > 0 {
+		// default json for RESTful
+		r.Body("application/json", bytes.NewReader(data))
 	}
-	return res
+	return r.Headers(hdr)
 }
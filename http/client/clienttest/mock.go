@@ -0,0 +1,354 @@
+// Package clienttest - test doubles for code using client.Client: a mock
+// transport with canned responses and call assertions, and a recorder
+// replaying real interactions from cassette files
+package clienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kelchy/go-lib/http/client"
+)
+
+// ErrNoRoute - returned for requests matching no route of the mock
+var ErrNoRoute = errors.New("clienttest: no route matches the request")
+
+// Call - request received by the mock, the body is read upfront
+type Call struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// Mock - http.RoundTripper answering requests with the response of the
+// first matching route, plug it with client.WithTransport or Client
+type Mock struct {
+	mu        sync.Mutex
+	routes    []*Route
+	calls     []Call
+	unmatched []Call
+}
+
+// NewMock - creates a mock without routes
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+// Client - creates a client sending its requests to the mock, opts are
+// applied first
+func (m *Mock) Client(opts ...client.Option) (client.Client, error) {
+	return client.New(append(opts, client.WithTransport(m))...)
+}
+
+// On - adds a route for method ("" or "*" for any) and pattern, a
+// path.Match pattern matched against the path, or against scheme, host and
+// path when it contains "://"
+func (m *Mock) On(method string, pattern string) *Route {
+	r := &Route{mock: m, method: strings.ToUpper(method), pattern: pattern, status: http.StatusOK, header: http.Header{}}
+	m.mu.Lock()
+	m.routes = append(m.routes, r)
+	m.mu.Unlock()
+	return r
+}
+
+// RoundTrip - implements http.RoundTripper
+func (m *Mock) RoundTrip(req *http.Request) (*http.Response, error) {
+	call, e := newCall(req)
+	if e != nil {
+		return nil, e
+	}
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	var route *Route
+	for _, r := range m.routes {
+		if r.matches(call) {
+			route = r
+			break
+		}
+	}
+	if route == nil {
+		m.unmatched = append(m.unmatched, call)
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s %s", ErrNoRoute, call.Method, call.URL)
+	}
+	route.calls = append(route.calls, call)
+	m.mu.Unlock()
+	return route.respond(req, call)
+}
+
+// Calls - requests received, matched or not
+func (m *Mock) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// Reset - forgets the calls, routes are kept
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls, m.unmatched = nil, nil
+	for _, r := range m.routes {
+		r.calls = nil
+	}
+}
+
+// AssertExpectations - fails t when a route was not called as often as
+// expected, see Route.Times, or a request matched no route
+func (m *Mock) AssertExpectations(t testing.TB) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.routes {
+		if r.times > 0 && len(r.calls) != r.times {
+			t.Errorf("clienttest: %s expected %d calls, got %d", r, r.times, len(r.calls))
+		} else if r.times == 0 && len(r.calls) == 0 {
+			t.Errorf("clienttest: %s was not called", r)
+		}
+	}
+	for _, c := range m.unmatched {
+		t.Errorf("clienttest: unexpected request %s %s", c.Method, c.URL)
+	}
+}
+
+// Route - matchers and canned response of the mock
+type Route struct {
+	mock     *Mock
+	method   string
+	pattern  string
+	matchers []func(Call) bool
+	times    int
+	once     bool
+
+	status  int
+	header  http.Header
+	body    []byte
+	err     error
+	handler func(*http.Request) (*http.Response, error)
+
+	calls []Call
+}
+
+func (r *Route) String() string {
+	method := r.method
+	if method == "" {
+		method = "*"
+	}
+	return method + " " + r.pattern
+}
+
+// Header - only matches requests with the header set to value
+func (r *Route) Header(key string, value string) *Route {
+	return r.Match(func(c Call) bool { return c.Header.Get(key) == value })
+}
+
+// Query - only matches requests with the query parameter set to value
+func (r *Route) Query(key string, value string) *Route {
+	return r.Match(func(c Call) bool { return c.URL.Query().Get(key) == value })
+}
+
+// Body - only matches requests whose body contains s
+func (r *Route) Body(s string) *Route {
+	return r.Match(func(c Call) bool { return bytes.Contains(c.Body, []byte(s)) })
+}
+
+// JSONBody - only matches requests whose json body equals v once both are decoded
+func (r *Route) JSONBody(v interface{}) *Route {
+	return r.Match(func(c Call) bool { return jsonEqual(c.Body, v) })
+}
+
+// Match - only matches requests accepted by fn
+func (r *Route) Match(fn func(Call) bool) *Route {
+	r.matchers = append(r.matchers, fn)
+	return r
+}
+
+// Times - expects exactly n calls, checked by AssertExpectations
+func (r *Route) Times(n int) *Route {
+	r.times = n
+	return r
+}
+
+// Once - the route stops matching after its first call, handy to chain
+// different responses to the same request
+func (r *Route) Once() *Route {
+	r.once = true
+	return r.Times(1)
+}
+
+// Reply - responds with status and body
+func (r *Route) Reply(status int, body string) *Route {
+	r.status, r.body = status, []byte(body)
+	return r
+}
+
+// ReplyJSON - responds with status and v encoded as json
+func (r *Route) ReplyJSON(status int, v interface{}) *Route {
+	data, e := json.Marshal(v)
+	if e != nil {
+		panic(e)
+	}
+	r.status, r.body = status, data
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// ReplyHeader - sets a header of the response
+func (r *Route) ReplyHeader(key string, value string) *Route {
+	r.header.Add(key, value)
+	return r
+}
+
+// ReplyError - fails the round trip with e, e.g. to simulate network errors
+func (r *Route) ReplyError(e error) *Route {
+	r.err = e
+	return r
+}
+
+// ReplyFunc - responds with fn, other replies are ignored
+func (r *Route) ReplyFunc(fn func(*http.Request) (*http.Response, error)) *Route {
+	r.handler = fn
+	return r
+}
+
+// Calls - requests matched by the route
+func (r *Route) Calls() []Call {
+	r.mock.mu.Lock()
+	defer r.mock.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// AssertCalled - fails t unless the route was called n times
+func (r *Route) AssertCalled(t testing.TB, n int) {
+	t.Helper()
+	if calls := r.Calls(); len(calls) != n {
+		t.Errorf("clienttest: %s expected %d calls, got %d", r, n, len(calls))
+	}
+}
+
+// AssertHeader - fails t unless the last call had the header set to value
+func (r *Route) AssertHeader(t testing.TB, key string, value string) {
+	t.Helper()
+	c, ok := r.last(t)
+	if ok && c.Header.Get(key) != value {
+		t.Errorf("clienttest: %s expected header %s %q, got %q", r, key, value, c.Header.Get(key))
+	}
+}
+
+// AssertBody - fails t unless the body of the last call equals body, json
+// bodies are compared once decoded
+func (r *Route) AssertBody(t testing.TB, body string) {
+	t.Helper()
+	c, ok := r.last(t)
+	if !ok || string(c.Body) == body {
+		return
+	}
+	var v interface{}
+	if json.Unmarshal([]byte(body), &v) == nil && jsonEqual(c.Body, v) {
+		return
+	}
+	t.Errorf("clienttest: %s expected body %s, got %s", r, body, c.Body)
+}
+
+func (r *Route) last(t testing.TB) (Call, bool) {
+	t.Helper()
+	calls := r.Calls()
+	if len(calls) == 0 {
+		t.Errorf("clienttest: %s was not called", r)
+		return Call{}, false
+	}
+	return calls[len(calls)-1], true
+}
+
+func (r *Route) matches(c Call) bool {
+	if r.once && len(r.calls) > 0 {
+		return false
+	}
+	if r.method != "" && r.method != "*" && r.method != c.Method {
+		return false
+	}
+	target := c.URL.Path
+	if strings.Contains(r.pattern, "://") {
+		target = c.URL.Scheme + "://" + c.URL.Host + c.URL.Path
+	}
+	if ok, _ := path.Match(r.pattern, target); !ok && r.pattern != target {
+		return false
+	}
+	for _, fn := range r.matchers {
+		if !fn(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Route) respond(req *http.Request, c Call) (*http.Response, error) {
+	if r.handler != nil {
+		// the handler gets the body the mock already read
+		req.Body = io.NopCloser(bytes.NewReader(c.Body))
+		return r.handler(req)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return NewResponse(req, r.status, r.header, r.body), nil
+}
+
+// NewResponse - builds the response to req, handy in ReplyFunc
+func NewResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	h := header.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// newCall reads the body of req, which is replaced so it can still be read
+func newCall(req *http.Request) (Call, error) {
+	c := Call{Method: req.Method, URL: req.URL, Header: req.Header.Clone()}
+	if req.Body != nil && req.Body != http.NoBody {
+		data, e := io.ReadAll(req.Body)
+		req.Body.Close()
+		if e != nil {
+			return c, e
+		}
+		c.Body = data
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	return c, nil
+}
+
+func jsonEqual(data []byte, v interface{}) bool {
+	var got, want interface{}
+	if json.Unmarshal(data, &got) != nil {
+		return false
+	}
+	// round trip so structs compare with decoded maps
+	encoded, e := json.Marshal(v)
+	if e != nil || json.Unmarshal(encoded, &want) != nil {
+		return false
+	}
+	return reflect.DeepEqual(got, want)
+}
@@ -0,0 +1,87 @@
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kelchy/go-lib/http/client"
+)
+
+// recordingT counts the failures instead of reporting them
+type recordingT struct {
+	testing.TB
+	errors int
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors++
+}
+
+func TestMock(t *testing.T) {
+	m := NewMock()
+	orders := m.On("POST", "/orders").Header("Authorization", "Bearer t0ken").ReplyJSON(201, map[string]int{"id": 7}).Times(1)
+	m.On("GET", "/orders/*").Query("expand", "items").Reply(200, `{"id":7,"items":[]}`)
+	m.On("GET", "https://api.example.com/flaky").Once().Reply(503, "")
+	m.On("GET", "https://api.example.com/flaky").Reply(200, `{}`)
+	m.On("*", "/down").ReplyError(errors.New("connection reset"))
+
+	c, err := m.Client(client.WithLogger("empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	res := c.Post(ctx, "https://api.example.com/orders", []byte(`{"sku": "a1", "qty": 2}`), map[string]string{"Authorization": "Bearer t0ken"})
+	if res.Error != nil || res.Response.StatusCode != 201 || string(res.JSON) != `{"id":7}` {
+		t.Fatalf("Unexpected response %v %d %s", res.Error, res.Response.StatusCode, res.JSON)
+	}
+	orders.AssertCalled(t, 1)
+	orders.AssertHeader(t, "Content-Type", "application/json")
+	orders.AssertBody(t, `{"qty":2,"sku":"a1"}`)
+
+	if res := c.Get(ctx, "https://api.example.com/orders/7?expand=items", nil, nil); res.Error != nil || !strings.Contains(string(res.JSON), "items") {
+		t.Fatalf("Expected wildcard route to match, got %v %s", res.Error, res.JSON)
+	}
+	first := c.Get(ctx, "https://api.example.com/flaky", nil, nil)
+	second := c.Get(ctx, "https://api.example.com/flaky", nil, nil)
+	if first.Response.StatusCode != 503 || second.Response.StatusCode != 200 {
+		t.Fatalf("Expected successive responses, got %d %d", first.Response.StatusCode, second.Response.StatusCode)
+	}
+	if res := c.Delete(ctx, "http://other/down", nil, nil); res.Error == nil || !strings.Contains(res.Error.Error(), "connection reset") {
+		t.Fatalf("Expected transport error, got %v", res.Error)
+	}
+	m.AssertExpectations(t)
+
+	if res := c.Get(ctx, "https://api.example.com/unknown", nil, nil); !errors.Is(res.Error, ErrNoRoute) {
+		t.Fatalf("Expected ErrNoRoute, got %v", res.Error)
+	}
+	if len(m.Calls()) != 6 {
+		t.Fatalf("Expected every call to be recorded, got %d", len(m.Calls()))
+	}
+
+	// expectations failing are reported on t
+	rec := &recordingT{TB: t}
+	m.Reset()
+	m.AssertExpectations(rec)
+	if rec.errors == 0 {
+		t.Fatal("Expected uncalled routes to fail the expectations")
+	}
+}
+
+func TestMockReplyFunc(t *testing.T) {
+	m := NewMock()
+	m.On("PUT", "/echo").ReplyFunc(func(req *http.Request) (*http.Response, error) {
+		body := make([]byte, req.ContentLength)
+		req.Body.Read(body)
+		return NewResponse(req, 200, http.Header{"Content-Type": {"application/json"}}, body), nil
+	})
+	c, _ := m.Client(client.WithLogger("empty"))
+	res := c.Put(context.Background(), "http://svc/echo", []byte(`{"a":1}`), nil)
+	if res.Error != nil || string(res.JSON) != `{"a":1}` {
+		t.Fatalf("Expected echoed body, got %v %s", res.Error, res.JSON)
+	}
+}
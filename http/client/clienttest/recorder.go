@@ -0,0 +1,246 @@
+package clienttest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/kelchy/go-lib/http/client"
+)
+
+// Mode - behaviour of the Recorder
+type Mode int
+
+const (
+	// ModeAuto - replays the cassette when the file exists, records it otherwise
+	ModeAuto Mode = iota
+	// ModeReplay - only replays, requests missing from the cassette fail
+	ModeReplay
+	// ModeRecord - sends the requests and records them, overwriting the cassette
+	ModeRecord
+)
+
+// ErrNotRecorded - returned in replay for requests missing from the cassette
+var ErrNotRecorded = errors.New("clienttest: request not found in cassette")
+
+// Interaction - request and response of a cassette
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest - request of an interaction
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// RecordedResponse - response of an interaction
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Body - body stored as text, or base64 when it isn't valid utf-8
+type Body []byte
+
+// MarshalJSON - text bodies stay readable in the cassette
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON - accepts both forms written by MarshalJSON
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*b = []byte(s)
+		return nil
+	}
+	var encoded map[string]string
+	if e := json.Unmarshal(data, &encoded); e != nil {
+		return e
+	}
+	decoded, e := base64.StdEncoding.DecodeString(encoded["base64"])
+	*b = decoded
+	return e
+}
+
+// RecorderOptions - options of NewRecorder
+type RecorderOptions struct {
+	Mode Mode
+	// Transport - sends the requests while recording, defaults to http.DefaultTransport
+	Transport http.RoundTripper
+	// ScrubHeaders - headers whose values are replaced before saving, defaults
+	// to client.DefaultRedactHeaders
+	ScrubHeaders []string
+	// Scrub - edits interactions before they are saved, e.g. to hide tokens of bodies
+	Scrub func(*Interaction)
+	// Match - tells whether a recorded request answers req, defaults to the
+	// same method, url and body
+	Match func(req *http.Request, body []byte, recorded RecordedRequest) bool
+}
+
+// Recorder - http.RoundTripper recording real interactions to a cassette
+// file and replaying them, each recorded interaction is replayed once in
+// the recorded order so repeated requests get their successive responses
+type Recorder struct {
+	path         string
+	opts         RecorderOptions
+	mode         Mode
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder - creates a recorder of the cassette at path, interactions
+// are written by Save
+func NewRecorder(path string, opts RecorderOptions) (*Recorder, error) {
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+	if opts.ScrubHeaders == nil {
+		opts.ScrubHeaders = client.DefaultRedactHeaders
+	}
+	if opts.Match == nil {
+		opts.Match = defaultMatch
+	}
+	r := &Recorder{path: path, opts: opts, mode: opts.Mode}
+	if r.mode == ModeAuto {
+		r.mode = ModeRecord
+		if _, e := os.Stat(path); e == nil {
+			r.mode = ModeReplay
+		}
+	}
+	if r.mode == ModeRecord {
+		return r, nil
+	}
+	data, e := os.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+	if e := json.Unmarshal(data, &r.interactions); e != nil {
+		return nil, fmt.Errorf("clienttest: invalid cassette %s: %w", path, e)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// Mode - mode in use, ModeAuto resolved
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client - creates a client sending its requests to the recorder, opts are
+// applied first
+func (r *Recorder) Client(opts ...client.Option) (client.Client, error) {
+	return client.New(append(opts, client.WithTransport(r))...)
+}
+
+// RoundTrip - implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	call, e := newCall(req)
+	if e != nil {
+		return nil, e
+	}
+	if r.mode == ModeReplay {
+		return r.replay(req, call.Body)
+	}
+	return r.record(req, call.Body)
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.interactions {
+		if !r.used[i] && r.opts.Match(req, body, in.Request) {
+			r.used[i] = true
+			return NewResponse(req, in.Response.Status, in.Response.Header, in.Response.Body), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, req.URL)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	// the transport compresses and decompresses itself so cassettes stay readable
+	out.Header.Del("Accept-Encoding")
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, e := r.opts.Transport.RoundTrip(out)
+	if e != nil {
+		return nil, e
+	}
+	data, e := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if e != nil {
+		return nil, e
+	}
+	header := resp.Header.Clone()
+	header.Del("Content-Length")
+	in := Interaction{
+		Request:  RecordedRequest{Method: req.Method, URL: req.URL.String(), Header: req.Header.Clone(), Body: body},
+		Response: RecordedResponse{Status: resp.StatusCode, Header: header, Body: data},
+	}
+	r.scrub(&in)
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.mu.Unlock()
+	return NewResponse(req, resp.StatusCode, resp.Header, data), nil
+}
+
+func (r *Recorder) scrub(in *Interaction) {
+	for _, name := range r.opts.ScrubHeaders {
+		for _, h := range []http.Header{in.Request.Header, in.Response.Header} {
+			if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+				h.Set(name, client.REDACTED)
+			}
+		}
+	}
+	if r.opts.Scrub != nil {
+		r.opts.Scrub(in)
+	}
+}
+
+// Interactions - interactions of the cassette
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// Save - writes the recorded interactions to the cassette, nothing is
+// written in replay
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	data, e := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if e != nil {
+		return e
+	}
+	if e := os.MkdirAll(filepath.Dir(r.path), 0755); e != nil {
+		return e
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+func defaultMatch(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	return req.Method == recorded.Method && req.URL.String() == recorded.URL && bytes.Equal(body, recorded.Body)
+}
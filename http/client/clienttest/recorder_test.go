@@ -0,0 +1,70 @@
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kelchy/go-lib/http/client"
+)
+
+func TestRecorder(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"call":%d,"path":%q}`, n, r.URL.Path)
+	}))
+	defer srv.Close()
+	cassette := filepath.Join(t.TempDir(), "fixtures", "orders.json")
+	ctx := context.Background()
+	hdr := map[string]string{"Authorization": "Bearer t0ken"}
+
+	// records the real interactions on the first run
+	rec, err := NewRecorder(cassette, RecorderOptions{})
+	if err != nil || rec.Mode() != ModeRecord {
+		t.Fatalf("Expected record mode without cassette, got %v %v", rec, err)
+	}
+	c, _ := rec.Client(client.WithLogger("empty"))
+	c.Get(ctx, srv.URL+"/orders", nil, hdr)
+	c.Get(ctx, srv.URL+"/orders", nil, hdr)
+	c.Post(ctx, srv.URL+"/orders", []byte(`{"sku":"a1"}`), hdr)
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(cassette)
+	if strings.Contains(string(data), "t0ken") || strings.Contains(string(data), "session=secret") || !strings.Contains(string(data), client.REDACTED) {
+		t.Fatalf("Expected sensitive headers to be scrubbed %s", data)
+	}
+
+	// replays them without reaching the server
+	rec, err = NewRecorder(cassette, RecorderOptions{})
+	if err != nil || rec.Mode() != ModeReplay {
+		t.Fatalf("Expected replay mode with cassette, got %v", err)
+	}
+	c, _ = rec.Client(client.WithLogger("empty"))
+	first := c.Get(ctx, srv.URL+"/orders", nil, nil)
+	second := c.Get(ctx, srv.URL+"/orders", nil, nil)
+	post := c.Post(ctx, srv.URL+"/orders", []byte(`{"sku":"a1"}`), nil)
+	if string(first.JSON) != `{"call":1,"path":"/orders"}` || string(second.JSON) != `{"call":2,"path":"/orders"}` || string(post.JSON) != `{"call":3,"path":"/orders"}` {
+		t.Fatalf("Unexpected replay %s %s %s", first.JSON, second.JSON, post.JSON)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected replay not to reach the server, got %d calls", calls)
+	}
+	if res := c.Get(ctx, srv.URL+"/orders", nil, nil); !errors.Is(res.Error, ErrNotRecorded) {
+		t.Fatalf("Expected ErrNotRecorded once the cassette is used up, got %v", res.Error)
+	}
+
+	if _, err := NewRecorder(filepath.Join(t.TempDir(), "missing.json"), RecorderOptions{Mode: ModeReplay}); err == nil {
+		t.Fatal("Expected missing cassette to fail in replay mode")
+	}
+}
@@ -1,7 +1,8 @@
-//v0.1.0
+//v0.1.19
 module github.com/kelchy/go-lib/http/client
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/kelchy/go-lib/log v0.0.10
 	golang.org/x/net v0.0.0-20220826154423-83b083e8dc8b
 )
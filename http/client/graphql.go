@@ -0,0 +1,310 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// GraphQLOptions - options of NewGraphQL
+type GraphQLOptions struct {
+	// Persisted - sends the sha256 hash of the query first and the query only
+	// when the server doesn't know it yet, automatic persisted queries (APQ)
+	Persisted bool
+	// PersistedGET - sends hash only queries with GET so CDNs can cache them,
+	// mutations are always POSTed
+	PersistedGET bool
+	// Header - headers added to every request
+	Header map[string]string
+}
+
+// GraphQLRequest - operation sent to the server
+type GraphQLRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLLocation - position in the query an error refers to
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError - entry of the errors array of a response
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		b, _ := json.Marshal(p)
+		path[i] = strings.Trim(string(b), `"`)
+	}
+	return strings.Join(path, ".") + ": " + e.Message
+}
+
+// Code - extensions.code of the error, empty if missing
+func (e GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// GraphQLErrors - errors returned by the server, data may still be
+// partially decoded
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// GraphQL - GraphQL client sending operations with c, its retries,
+// middlewares and logging apply, queries are retried like idempotent methods
+type GraphQL struct {
+	client   Client
+	endpoint string
+	opts     GraphQLOptions
+}
+
+// NewGraphQL - creates a GraphQL client of the endpoint
+func NewGraphQL(c Client, endpoint string, opts GraphQLOptions) *GraphQL {
+	return &GraphQL{client: c, endpoint: endpoint, opts: opts}
+}
+
+// Query - sends query with variables and decodes the data into v, see Do
+func (g *GraphQL) Query(ctx context.Context, query string, variables map[string]interface{}, v interface{}) error {
+	return g.Do(ctx, GraphQLRequest{Query: query, Variables: variables}, v)
+}
+
+// Do - sends the operation and decodes the data into v, errors of the
+// response are returned as GraphQLErrors after data is decoded
+func (g *GraphQL) Do(ctx context.Context, op GraphQLRequest, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	mutation := isMutation(op.Query, op.OperationName)
+	if !mutation {
+		ctx = context.WithValue(ctx, idempotentKey{}, true)
+	}
+	if !g.opts.Persisted {
+		return g.send(ctx, op, v, false)
+	}
+	hash := sha256.Sum256([]byte(op.Query))
+	persisted := op
+	persisted.Query = ""
+	persisted.Extensions = map[string]interface{}{}
+	for k, ext := range op.Extensions {
+		persisted.Extensions[k] = ext
+	}
+	persisted.Extensions["persistedQuery"] = map[string]interface{}{
+		"version":    1,
+		"sha256Hash": hex.EncodeToString(hash[:]),
+	}
+	e := g.send(ctx, persisted, v, g.opts.PersistedGET && !mutation)
+	var errs GraphQLErrors
+	if !errors.As(e, &errs) || !persistedQueryNotFound(errs) {
+		return e
+	}
+	// the server registers the query along with its hash
+	persisted.Query = op.Query
+	return g.send(ctx, persisted, v, false)
+}
+
+// GraphQLQuery - sends query with variables and returns the data decoded
+// into T, see GraphQL.Do
+func GraphQLQuery[T any](ctx context.Context, g *GraphQL, query string, variables map[string]interface{}) (T, error) {
+	var data T
+	e := g.Do(ctx, GraphQLRequest{Query: query, Variables: variables}, &data)
+	return data, e
+}
+
+// graphqlResponse - envelope of the response
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+func (g *GraphQL) send(ctx context.Context, op GraphQLRequest, v interface{}, get bool) error {
+	var r *Request
+	if get {
+		r = g.client.Request(http.MethodGet, g.endpoint)
+		if op.OperationName != "" {
+			r.Query("operationName", op.OperationName)
+		}
+		for name, value := range map[string]map[string]interface{}{"variables": op.Variables, "extensions": op.Extensions} {
+			if len(value) == 0 {
+				continue
+			}
+			data, e := json.Marshal(value)
+			if e != nil {
+				return e
+			}
+			r.Query(name, string(data))
+		}
+	} else {
+		r = g.client.Request(http.MethodPost, g.endpoint).JSON(op)
+	}
+	res := r.SetHeader("Accept", "application/graphql-response+json, application/json").Headers(g.opts.Header).Stream(ctx)
+	var se *StatusError
+	if errors.As(res.Error, &se) {
+		// servers answer errors of the operation with 4xx too
+		var body graphqlResponse
+		if json.Unmarshal(se.Body, &body) == nil && len(body.Errors) > 0 {
+			return body.Errors
+		}
+		return res.Error
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	data, e := res.Bytes()
+	if e != nil {
+		return e
+	}
+	var body graphqlResponse
+	if e := json.Unmarshal(data, &body); e != nil || (len(body.Errors) == 0 && !success(res.Response.StatusCode)) {
+		// not a GraphQL response, e.g. a proxy error page
+		return &StatusError{
+			StatusCode: res.Response.StatusCode,
+			Status:     res.Response.Status,
+			Header:     res.Response.Header,
+			Body:       data,
+		}
+	}
+	if v != nil && len(body.Data) > 0 && string(body.Data) != "null" {
+		if e := json.Unmarshal(body.Data, v); e != nil {
+			return e
+		}
+	}
+	if len(body.Errors) > 0 {
+		return body.Errors
+	}
+	return nil
+}
+
+// isMutation tells whether the operation selected by operationName is a
+// mutation, documents it can't tell, e.g. several operations and no name, are
+// treated as mutations so they are never retried
+func isMutation(query string, operationName string) bool {
+	ops, ok := graphQLOperations(query)
+	if !ok {
+		return true
+	}
+	for _, op := range ops {
+		if (operationName == "" && len(ops) == 1) || (operationName != "" && op.name == operationName) {
+			return op.kind == "mutation"
+		}
+	}
+	return true
+}
+
+type graphQLOperation struct {
+	kind string
+	name string
+}
+
+// graphQLOperations lists the operations of the document with their type,
+// fragments are skipped, ok is false when the document can't be read
+func graphQLOperations(query string) (ops []graphQLOperation, ok bool) {
+	var cur *graphQLOperation
+	named, directive := false, false
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case ch == '"':
+			if strings.HasPrefix(query[i:], `"""`) {
+				end := strings.Index(query[i+3:], `"""`)
+				if end < 0 {
+					return nil, false
+				}
+				i += end + 5
+				continue
+			}
+			for i++; i < len(query) && query[i] != '"'; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(query) {
+				return nil, false
+			}
+		case ch == '{' || ch == '(':
+			if depth == 0 {
+				if cur == nil && ch == '{' {
+					// shorthand query
+					cur = &graphQLOperation{kind: "query"}
+				}
+				if cur == nil {
+					return nil, false
+				}
+				named = true
+			}
+			depth++
+		case ch == '}' || ch == ')':
+			depth--
+			if depth < 0 {
+				return nil, false
+			}
+			if depth == 0 && ch == '}' {
+				if cur.kind != "fragment" {
+					ops = append(ops, *cur)
+				}
+				cur = nil
+			}
+		case ch == '@':
+			directive = true
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			start := i
+			for i+1 < len(query) && (query[i+1] == '_' || query[i+1] >= 'a' && query[i+1] <= 'z' || query[i+1] >= 'A' && query[i+1] <= 'Z' || query[i+1] >= '0' && query[i+1] <= '9') {
+				i++
+			}
+			name := query[start : i+1]
+			if depth > 0 || directive {
+				directive = false
+				continue
+			}
+			switch {
+			case cur == nil && (name == "query" || name == "mutation" || name == "subscription" || name == "fragment"):
+				cur = &graphQLOperation{kind: name}
+				named = name == "fragment"
+			case cur == nil:
+				// type system definitions and unknown keywords
+				return nil, false
+			case !named:
+				cur.name = name
+				named = true
+			}
+		}
+	}
+	return ops, depth == 0 && cur == nil
+}
+
+func persistedQueryNotFound(errs GraphQLErrors) bool {
+	for _, e := range errs {
+		if e.Message == "PersistedQueryNotFound" || e.Code() == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
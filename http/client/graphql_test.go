@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGraphQL(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var op GraphQLRequest
+		json.NewDecoder(r.Body).Decode(&op)
+		w.Header().Set("Content-Type", "application/json")
+		switch op.OperationName {
+		case "Flaky":
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "Partial":
+			w.Write([]byte(`{"data":{"user":{"name":"kim","email":null}},"errors":[{"message":"forbidden","path":["user","email"],"locations":[{"line":1,"column":30}],"extensions":{"code":"FORBIDDEN"}}]}`))
+			return
+		case "Invalid":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"message":"Cannot query field \"nope\""}]}`))
+			return
+		}
+		if r.Header.Get("X-Partner") != "acme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"user": map[string]interface{}{"name": op.Variables["id"]}}})
+	}))
+	defer srv.Close()
+
+	type user struct {
+		User struct {
+			Name  string
+			Email *string
+		}
+	}
+	c, _ := New(WithLogger("empty"), WithRetry(RetryPolicy{MaxAttempts: 2}), WithStatusErrors(true))
+	gql := NewGraphQL(c, srv.URL, GraphQLOptions{Header: map[string]string{"X-Partner": "acme"}})
+	data, err := GraphQLQuery[user](context.Background(), gql, `query { user(id: $id) { name } }`, map[string]interface{}{"id": "kim"})
+	if err != nil || data.User.Name != "kim" {
+		t.Fatalf("Unexpected result %+v %v", data, err)
+	}
+
+	// queries are retried, POST or not
+	var out user
+	if err := gql.Do(context.Background(), GraphQLRequest{Query: `query Flaky { user { name } }`, OperationName: "Flaky", Variables: map[string]interface{}{"id": "lee"}}, &out); err != nil || attempts != 2 {
+		t.Fatalf("Expected query to be retried, got %v after %d attempts", err, attempts)
+	}
+
+	// partial data comes with typed errors
+	out = user{}
+	err = gql.Do(context.Background(), GraphQLRequest{Query: `query Partial { user { name email } }`, OperationName: "Partial"}, &out)
+	var errs GraphQLErrors
+	if !errors.As(err, &errs) || out.User.Name != "kim" {
+		t.Fatalf("Expected partial data with errors, got %+v %v", out, err)
+	}
+	if e := errs[0]; e.Code() != "FORBIDDEN" || e.Locations[0].Column != 30 || e.Error() != "user.email: forbidden" {
+		t.Fatalf("Unexpected error %+v %s", e, e.Error())
+	}
+	if err := gql.Do(context.Background(), GraphQLRequest{Query: `{ nope }`, OperationName: "Invalid"}, nil); !errors.As(err, &errs) {
+		t.Fatalf("Expected errors of 400 responses, got %v", err)
+	}
+
+	// not GraphQL responses surface the status
+	var se *StatusError
+	bare := NewGraphQL(c, srv.URL, GraphQLOptions{})
+	if err := bare.Query(context.Background(), `{ user { name } }`, nil, &out); !errors.As(err, &se) || se.StatusCode != 401 {
+		t.Fatalf("Expected StatusError, got %v", err)
+	}
+}
+
+func TestGraphQLPersisted(t *testing.T) {
+	var mu sync.Mutex
+	known := map[string]string{}
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var op GraphQLRequest
+		if r.Method == http.MethodGet {
+			json.Unmarshal([]byte(r.URL.Query().Get("extensions")), &op.Extensions)
+		} else {
+			json.NewDecoder(r.Body).Decode(&op)
+		}
+		hash := op.Extensions["persistedQuery"].(map[string]interface{})["sha256Hash"].(string)
+		mu.Lock()
+		defer mu.Unlock()
+		methods = append(methods, r.Method)
+		if op.Query != "" {
+			sum := sha256.Sum256([]byte(op.Query))
+			if hex.EncodeToString(sum[:]) != hash {
+				w.Write([]byte(`{"errors":[{"message":"provided sha does not match query"}]}`))
+				return
+			}
+			known[hash] = op.Query
+		}
+		if _, ok := known[hash]; !ok {
+			w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"ok":true}}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	gql := NewGraphQL(c, srv.URL, GraphQLOptions{Persisted: true, PersistedGET: true})
+	var out struct{ OK bool }
+	for i := 0; i < 2; i++ {
+		if err := gql.Query(context.Background(), `query { ok }`, nil, &out); err != nil || !out.OK {
+			t.Fatalf("Unexpected persisted query result %v %v", out, err)
+		}
+	}
+	if len(methods) != 3 || methods[0] != "GET" || methods[1] != "POST" || methods[2] != "GET" {
+		t.Fatalf("Expected hash, registration then hash only, got %v", methods)
+	}
+}
+
+func TestIsMutation(t *testing.T) {
+	tests := []struct {
+		query, name string
+		mutation    bool
+	}{
+		{`{ user { name } }`, "", false},
+		{`# comment
+		query Users($first: Int = 10) @cached { users(first: $first) { name } }`, "", false},
+		{`mutation { delete(id: 1) }`, "", true},
+		{`fragment F on User { name } mutation Rename { rename(name: "query { }") { ...F } }`, "", true},
+		{`fragment F on User { name } query Get { user { ...F } }`, "", false},
+		{`query Get { user { name } } mutation Save($in: Input = {a: "}"}) { save(in: $in) }`, "Save", true},
+		{`query Get { user { name } } mutation Save { save }`, "Get", false},
+		{`query Get { user { name } } mutation Save { save }`, "", true},
+		{`query Get { user { name } }`, "Other", true},
+		{`query Get { note(text: """ mutation { x } """) }`, "", false},
+		{`query Get { user { name }`, "", true},
+		{`type User { name: String }`, "", true},
+	}
+	for _, tt := range tests {
+		if got := isMutation(tt.query, tt.name); got != tt.mutation {
+			t.Errorf("isMutation(%q, %q) = %v, expected %v", tt.query, tt.name, got, tt.mutation)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP2Options - options of the http/2 mode, see WithHTTP2
+type HTTP2Options struct {
+	// ReadIdleTimeout - connections without frames for that long are checked
+	// with a ping, defaults to 30s
+	ReadIdleTimeout time.Duration
+	// PingTimeout - connections not answering the ping within it are closed,
+	// defaults to 15s
+	PingTimeout time.Duration
+	// DisableH2C - plaintext http urls use HTTP/1.1 instead of h2c
+	DisableH2C bool
+}
+
+// WithHTTP2 - uses http/2 with connection health checks: https urls negotiate
+// h2 with ALPN, falling back to HTTP/1.1 when the server doesn't support it,
+// and http urls use h2c with prior knowledge unless disabled. Transport
+// options still apply, proxies excepted for h2c
+func WithHTTP2(opts HTTP2Options) Option {
+	return func(cfg *config) error {
+		cfg.http2 = &opts
+		return nil
+	}
+}
+
+// NewHTTP2 - creates and returns http/2 client, see WithHTTP2, opts are the
+// options of New
+func NewHTTP2(opts ...Option) (Client, error) {
+	return New(append([]Option{WithHTTP2(HTTP2Options{})}, opts...)...)
+}
+
+// configure enables http/2 on the transport built by newTransport
+func (opts HTTP2Options) configure(t1 *http.Transport) error {
+	if opts.ReadIdleTimeout <= 0 {
+		opts.ReadIdleTimeout = 30 * time.Second
+	}
+	if opts.PingTimeout <= 0 {
+		opts.PingTimeout = 15 * time.Second
+	}
+	if t1.TLSClientConfig != nil {
+		// ConfigureTransports adds h2 to the protocols of the config, which
+		// may be shared with other clients
+		t1.TLSClientConfig = t1.TLSClientConfig.Clone()
+	}
+	t2, e := http2.ConfigureTransports(t1)
+	if e != nil {
+		return e
+	}
+	t2.ReadIdleTimeout = opts.ReadIdleTimeout
+	t2.PingTimeout = opts.PingTimeout
+	if opts.DisableH2C {
+		return nil
+	}
+	dial := t1.DialContext
+	t1.RegisterProtocol("http", &http2.Transport{
+		AllowHTTP: true,
+		// the transport dials tls for every url, h2c connections stay plain
+		DialTLSContext: func(ctx context.Context, network string, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		},
+		ReadIdleTimeout: opts.ReadIdleTimeout,
+		PingTimeout:     opts.PingTimeout,
+	})
+	return nil
+}
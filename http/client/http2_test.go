@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func protoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"proto":%q}`, r.Proto)
+	})
+}
+
+func TestNewHTTP2(t *testing.T) {
+	// h2c with prior knowledge for plaintext urls
+	plain := httptest.NewServer(h2c.NewHandler(protoHandler(), &http2.Server{}))
+	defer plain.Close()
+
+	// h2 negotiated with ALPN over tls
+	secure := httptest.NewUnstartedServer(protoHandler())
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	defer secure.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(secure.Certificate())
+
+	c, err := NewHTTP2(WithLogger("empty"), WithRootCAs(pool), WithRetry(RetryPolicy{MaxAttempts: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.JSON {
+		t.Fatal("Expected json parsing to be enabled like New")
+	}
+	for _, u := range []string{plain.URL, secure.URL} {
+		res := c.Get(context.Background(), u, nil, nil)
+		if res.Error != nil || string(res.JSON) != `{"proto":"HTTP/2.0"}` {
+			t.Fatalf("Expected http/2 to %s, got %v %s", u, res.Error, res.JSON)
+		}
+	}
+
+	// tls servers without h2 fall back to HTTP/1.1
+	legacy := httptest.NewTLSServer(protoHandler())
+	defer legacy.Close()
+	pool.AddCert(legacy.Certificate())
+	if res := c.Get(context.Background(), legacy.URL, nil, nil); res.Error != nil || string(res.JSON) != `{"proto":"HTTP/1.1"}` {
+		t.Fatalf("Expected HTTP/1.1 fallback, got %v %s", res.Error, res.JSON)
+	}
+
+	// the options of New still apply
+	c, _ = NewHTTP2(WithLogger("empty"), WithTimeouts(Timeouts{Request: 50 * time.Millisecond}), WithHTTP2(HTTP2Options{DisableH2C: true}))
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprintf(w, `{"proto":%q}`, r.Proto)
+	}))
+	defer slow.Close()
+	if res := c.Get(context.Background(), slow.URL, nil, nil); res.Error == nil {
+		t.Fatal("Expected request timeout to apply")
+	}
+	if res := c.Get(context.Background(), plain.URL, nil, nil); res.Error != nil || string(res.JSON) != `{"proto":"HTTP/1.1"}` {
+		t.Fatalf("Expected HTTP/1.1 with h2c disabled, got %v %s", res.Error, res.JSON)
+	}
+}
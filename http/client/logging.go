@@ -0,0 +1,180 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kelchy/go-lib/log"
+)
+
+// REDACTED - replaces redacted values in the logs
+const REDACTED = "REDACTED"
+
+// DefaultRedactHeaders - headers redacted when LoggingOptions.RedactHeaders is empty
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// LoggingOptions - options of the Logging middleware
+type LoggingOptions struct {
+	// Output - receives every log line, defaults to the standard logger with
+	// the scope HTTPC_LOG
+	Output func(scope string, msg string)
+	// Headers - log request and response headers
+	Headers bool
+	// MaxBody - log up to that many bytes of the request and response bodies,
+	// 0 logs no body
+	MaxBody int
+	// RedactHeaders - headers whose values are replaced, defaults to DefaultRedactHeaders
+	RedactHeaders []string
+	// RedactQuery - query parameters whose values are replaced
+	RedactQuery []string
+	// RedactFields - keys of json bodies whose values are replaced at any depth
+	RedactFields []string
+}
+
+// logLine - json line written for every attempt
+type logLine struct {
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Status     int                 `json:"status,omitempty"`
+	Ms         int64               `json:"ms"`
+	Error      string              `json:"error,omitempty"`
+	ReqHeaders map[string][]string `json:"req_headers,omitempty"`
+	ResHeaders map[string][]string `json:"res_headers,omitempty"`
+	ReqBody    string              `json:"req_body,omitempty"`
+	ResBody    string              `json:"res_body,omitempty"`
+}
+
+// Logging - middleware logging every attempt with its outcome, sensitive
+// headers, query parameters and json fields are redacted
+func Logging(opts LoggingOptions) Middleware {
+	if opts.Output == nil {
+		l, _ := log.New("")
+		opts.Output = l.Out
+	}
+	if len(opts.RedactHeaders) == 0 {
+		opts.RedactHeaders = DefaultRedactHeaders
+	}
+	// textual redaction of bodies which are not valid json
+	var fields []*regexp.Regexp
+	for _, f := range opts.RedactFields {
+		fields = append(fields, regexp.MustCompile(`(?i)("`+regexp.QuoteMeta(f)+`"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`))
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			line := logLine{Method: req.Method, URL: opts.redactURL(req)}
+			if opts.Headers {
+				line.ReqHeaders = opts.redactHeaders(req.Header)
+			}
+			if opts.MaxBody > 0 && req.GetBody != nil {
+				if body, e := req.GetBody(); e == nil {
+					data, _ := io.ReadAll(io.LimitReader(body, int64(opts.MaxBody)+1))
+					body.Close()
+					line.ReqBody = opts.redactBody(data, fields)
+				}
+			}
+			start := time.Now()
+			resp, e := next.RoundTrip(req)
+			line.Ms = time.Since(start).Milliseconds()
+			if e != nil {
+				line.Error = e.Error()
+			} else {
+				line.Status = resp.StatusCode
+				if opts.Headers {
+					line.ResHeaders = opts.redactHeaders(resp.Header)
+				}
+				if opts.MaxBody > 0 && resp.Body != nil {
+					// read the start of the body and put it back in front of the rest
+					data, _ := io.ReadAll(io.LimitReader(resp.Body, int64(opts.MaxBody)+1))
+					resp.Body = struct {
+						io.Reader
+						io.Closer
+					}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+					line.ResBody = opts.redactBody(data, fields)
+				}
+			}
+			if j, e := json.Marshal(line); e == nil {
+				opts.Output("HTTPC_LOG", string(j))
+			}
+			return resp, e
+		})
+	}
+}
+
+func (opts LoggingOptions) redactURL(req *http.Request) string {
+	u := *req.URL
+	if len(opts.RedactQuery) > 0 && u.RawQuery != "" {
+		q := u.Query()
+		for _, k := range opts.RedactQuery {
+			if _, ok := q[k]; ok {
+				q.Set(k, REDACTED)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+func (opts LoggingOptions) redactHeaders(h http.Header) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, vs := range h {
+		out[k] = vs
+		for _, r := range opts.RedactHeaders {
+			if strings.EqualFold(k, r) {
+				out[k] = []string{REDACTED}
+				break
+			}
+		}
+	}
+	return out
+}
+
+// redactBody truncates the body to MaxBody and redacts json fields, bodies
+// which are not valid json, e.g. truncated ones, are redacted textually
+func (opts LoggingOptions) redactBody(data []byte, fields []*regexp.Regexp) string {
+	truncated := len(data) > opts.MaxBody
+	if truncated {
+		data = data[:opts.MaxBody]
+	}
+	body := string(data)
+	if len(opts.RedactFields) > 0 {
+		var v interface{}
+		if !truncated && json.Unmarshal(data, &v) == nil {
+			if redacted, e := json.Marshal(opts.redactValue(v)); e == nil {
+				body = string(redacted)
+			}
+		} else {
+			for _, re := range fields {
+				body = re.ReplaceAllString(body, `${1}"`+REDACTED+`"`)
+			}
+		}
+	}
+	if truncated {
+		body += "..."
+	}
+	return body
+}
+
+func (opts LoggingOptions) redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			t[k] = opts.redactValue(child)
+			for _, f := range opts.RedactFields {
+				if strings.EqualFold(k, f) {
+					t[k] = REDACTED
+					break
+				}
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = opts.redactValue(t[i])
+		}
+	}
+	return v
+}
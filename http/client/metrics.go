@@ -0,0 +1,104 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HostStats - counters of a host collected by Metrics
+type HostStats struct {
+	Requests int64
+	// Errors - attempts failing without a response
+	Errors int64
+	// Statuses - responses per status code
+	Statuses map[int]int64
+	// Latency - total time spent, see Mean
+	Latency time.Duration
+	// Max - slowest attempt
+	Max time.Duration
+}
+
+// Mean - average latency of the host
+func (s HostStats) Mean() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.Latency / time.Duration(s.Requests)
+}
+
+// Metrics - per host latency and status metrics, created by NewMetrics
+type Metrics struct {
+	mu      sync.Mutex
+	hosts   map[string]*HostStats
+	observe func(host string, status int, latency time.Duration, err error)
+}
+
+// NewMetrics - creates the metrics, observe is called after every attempt to
+// export them elsewhere, e.g. to prometheus, and may be nil. The status is 0
+// when the attempt failed
+func NewMetrics(observe func(host string, status int, latency time.Duration, err error)) *Metrics {
+	return &Metrics{hosts: map[string]*HostStats{}, observe: observe}
+}
+
+// Middleware - middleware recording every attempt
+func (m *Metrics) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, e := next.RoundTrip(req)
+			status := 0
+			if e == nil {
+				status = resp.StatusCode
+			}
+			m.record(req.URL.Host, status, time.Since(start), e)
+			return resp, e
+		})
+	}
+}
+
+func (m *Metrics) record(host string, status int, latency time.Duration, e error) {
+	m.mu.Lock()
+	s, ok := m.hosts[host]
+	if !ok {
+		s = &HostStats{Statuses: map[int]int64{}}
+		m.hosts[host] = s
+	}
+	s.Requests++
+	if e != nil {
+		s.Errors++
+	} else {
+		s.Statuses[status]++
+	}
+	s.Latency += latency
+	if latency > s.Max {
+		s.Max = latency
+	}
+	m.mu.Unlock()
+	if m.observe != nil {
+		m.observe(host, status, latency, e)
+	}
+}
+
+// Stats - copy of the counters per host
+func (m *Metrics) Stats() map[string]HostStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make(map[string]HostStats, len(m.hosts))
+	for host, s := range m.hosts {
+		c := *s
+		c.Statuses = make(map[int]int64, len(s.Statuses))
+		for k, v := range s.Statuses {
+			c.Statuses[k] = v
+		}
+		stats[host] = c
+	}
+	return stats
+}
+
+// Reset - clears the counters
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	m.hosts = map[string]*HostStats{}
+	m.mu.Unlock()
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// names of the built-in middlewares, any name can be used with Use
+const (
+	MiddlewareLogging = "logging"
+	MiddlewareTrace   = "trace"
+	MiddlewareMetrics = "metrics"
+)
+
+// Middleware - wraps every attempt of a request, retries and the circuit
+// breaker run outside of the chain so each attempt goes through it
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripFunc - adapter to use a function as http.RoundTripper
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip - calls f(req)
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type namedMiddleware struct {
+	name string
+	mw   Middleware
+}
+
+// Use - appends the middleware to the chain, the first one registered runs
+// first, using a name again replaces the middleware in place
+func (c *Client) Use(name string, mw Middleware) {
+	c.insert(name, mw, len(c.middlewares))
+}
+
+// UseBefore - inserts the middleware before the one named before, appends it
+// when there is no such middleware
+func (c *Client) UseBefore(before string, name string, mw Middleware) {
+	c.Remove(name)
+	for i, m := range c.middlewares {
+		if m.name == before {
+			c.insert(name, mw, i)
+			return
+		}
+	}
+	c.insert(name, mw, len(c.middlewares))
+}
+
+// Remove - removes the middleware from the chain
+func (c *Client) Remove(name string) {
+	var mws []namedMiddleware
+	for _, m := range c.middlewares {
+		if m.name != name {
+			mws = append(mws, m)
+		}
+	}
+	c.middlewares = mws
+}
+
+// Middlewares - names of the middlewares in the order they run
+func (c Client) Middlewares() []string {
+	names := make([]string, len(c.middlewares))
+	for i, m := range c.middlewares {
+		names[i] = m.name
+	}
+	return names
+}
+
+// insert copies the chain so copies of the client keep their own
+func (c *Client) insert(name string, mw Middleware, at int) {
+	mws := make([]namedMiddleware, 0, len(c.middlewares)+1)
+	for i, m := range c.middlewares {
+		if m.name == name {
+			// replace in place
+			mws = append(mws, c.middlewares[:i]...)
+			mws = append(mws, namedMiddleware{name, mw})
+			c.middlewares = append(mws, c.middlewares[i+1:]...)
+			return
+		}
+	}
+	mws = append(mws, c.middlewares[:at]...)
+	mws = append(mws, namedMiddleware{name, mw})
+	c.middlewares = append(mws, c.middlewares[at:]...)
+}
+
+type withoutKey struct{}
+
+// WithoutMiddleware - returns a context skipping the named middlewares for
+// calls made with it
+func WithoutMiddleware(ctx context.Context, names ...string) context.Context {
+	skip := map[string]bool{}
+	if prev, ok := ctx.Value(withoutKey{}).(map[string]bool); ok {
+		for k := range prev {
+			skip[k] = true
+		}
+	}
+	for _, name := range names {
+		skip[name] = true
+	}
+	return context.WithValue(ctx, withoutKey{}, skip)
+}
+
+// roundTrip sends one attempt through the middleware chain
+func (c Client) roundTrip(req *http.Request) (*http.Response, error) {
+	var next http.RoundTripper = RoundTripFunc(c.Client.Do)
+	if len(c.middlewares) == 0 {
+		return next.RoundTrip(req)
+	}
+	skip, _ := req.Context().Value(withoutKey{}).(map[string]bool)
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		if m := c.middlewares[i]; !skip[m.name] {
+			next = m.mw(next)
+		}
+	}
+	return next.RoundTrip(req)
+}
+
+// OnRequest - middleware calling fn with a copy of every request before it is
+// sent, e.g. to inject headers, an error aborts the attempt
+func OnRequest(fn func(req *http.Request) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			// the original request is reused by retries
+			clone := req.Clone(req.Context())
+			if e := fn(clone); e != nil {
+				return nil, e
+			}
+			return next.RoundTrip(clone)
+		})
+	}
+}
+
+// OnResponse - middleware calling fn with every response, an error is returned
+// to the caller instead of the response, whose body is then closed
+func OnResponse(fn func(resp *http.Response) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp, e := next.RoundTrip(req)
+			if e != nil {
+				return resp, e
+			}
+			if e := fn(resp); e != nil {
+				resp.Body.Close()
+				return nil, e
+			}
+			return resp, nil
+		})
+	}
+}
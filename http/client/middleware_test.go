@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var seen http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var order []string
+	track := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	c, _ := New(WithLogger("empty"), WithMiddleware("a", track("a")))
+	c.Use("c", track("c"))
+	c.UseBefore("c", "b", track("b"))
+	c.Use("auth", OnRequest(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer injected")
+		return nil
+	}))
+	if names := strings.Join(c.Middlewares(), ","); names != "a,b,c,auth" {
+		t.Fatalf("Unexpected middlewares %s", names)
+	}
+
+	// copies keep their own chain
+	other := c
+	other.Remove("a")
+	if len(c.Middlewares()) != 4 || len(other.Middlewares()) != 3 {
+		t.Fatal("Expected copies of the client to keep their own chain")
+	}
+
+	res := c.Get(context.Background(), srv.URL, nil, nil)
+	if res.Error != nil || strings.Join(order, ",") != "a,b,c" || seen.Get("Authorization") != "Bearer injected" {
+		t.Fatalf("Unexpected chain result %v %v %v", res.Error, order, seen)
+	}
+
+	order = nil
+	c.Request("GET", srv.URL).Without("b", "auth").Do(context.Background())
+	if strings.Join(order, ",") != "a,c" || seen.Get("Authorization") != "" {
+		t.Fatalf("Expected middlewares to be skipped, got %v %v", order, seen)
+	}
+	order = nil
+	c.Get(WithoutMiddleware(context.Background(), "a"), srv.URL, nil, nil)
+	if strings.Join(order, ",") != "b,c" {
+		t.Fatalf("Expected middleware to be skipped by context, got %v", order)
+	}
+
+	denied := errors.New("denied")
+	c.Use("deny", OnResponse(func(resp *http.Response) error {
+		return denied
+	}))
+	if res := c.Get(context.Background(), srv.URL, nil, nil); !errors.Is(res.Error, denied) {
+		t.Fatalf("Expected response interceptor error, got %v", res.Error)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(`{"user":{"name":"kim","password":"hunter2"},"token":"abc"}`))
+	}))
+	defer srv.Close()
+
+	var lines []string
+	c, _ := New(WithLogger("empty"))
+	c.Use(MiddlewareLogging, Logging(LoggingOptions{
+		Output: func(scope string, msg string) {
+			lines = append(lines, msg)
+		},
+		Headers:      true,
+		MaxBody:      1024,
+		RedactQuery:  []string{"key"},
+		RedactFields: []string{"password", "token"},
+	}))
+	res := c.Request("POST", srv.URL).
+		Query("key", "k1").
+		BearerAuth("t0ken").
+		JSON(map[string]string{"password": "p4ss", "name": "kim"}).
+		Do(context.Background())
+	if res.Error != nil || !strings.Contains(string(res.JSON), "hunter2") {
+		t.Fatalf("Expected body to reach the caller intact, got %v %s", res.Error, res.JSON)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("Expected one log line, got %v", lines)
+	}
+	var line logLine
+	if e := json.Unmarshal([]byte(lines[0]), &line); e != nil {
+		t.Fatal(e)
+	}
+	u, _ := url.Parse(line.URL)
+	if line.Method != "POST" || line.Status != 200 || u.Query().Get("key") != REDACTED {
+		t.Fatalf("Unexpected log line %s", lines[0])
+	}
+	if line.ReqHeaders["Authorization"][0] != REDACTED || line.ResHeaders["Set-Cookie"][0] != REDACTED {
+		t.Fatalf("Expected headers to be redacted %s", lines[0])
+	}
+	for _, secret := range []string{"t0ken", "p4ss", "hunter2", "abc", "k1", "session=secret"} {
+		if strings.Contains(lines[0], secret) {
+			t.Fatalf("Expected %s to be redacted %s", secret, lines[0])
+		}
+	}
+
+	// truncated bodies are redacted textually
+	lines = nil
+	c.Use(MiddlewareLogging, Logging(LoggingOptions{
+		Output:       func(scope string, msg string) { lines = append(lines, msg) },
+		MaxBody:      40,
+		RedactFields: []string{"password"},
+	}))
+	c.Get(context.Background(), srv.URL, nil, nil)
+	if len(lines) != 1 || strings.Contains(lines[0], "hunter") {
+		t.Fatalf("Expected truncated body to be redacted %v", lines)
+	}
+}
+
+func TestTraceMiddleware(t *testing.T) {
+	var seen http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"), WithMiddleware(MiddlewareTrace, Trace(func(ctx context.Context, hdr http.Header) {
+		hdr.Set("X-Extracted", "yes")
+	})))
+
+	incoming := httptest.NewRequest("GET", "/orders", nil)
+	incoming.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Header.Set("X-Request-Id", "req-1")
+	incoming.Header.Set("Authorization", "Bearer not-propagated")
+	ctx := TraceContext(context.Background(), incoming)
+	ctx = TraceHeader(ctx, "X-Tenant", "acme")
+
+	c.Get(ctx, srv.URL, nil, map[string]string{"X-Request-Id": "explicit"})
+	if seen.Get("Traceparent") != incoming.Header.Get("traceparent") || seen.Get("X-Tenant") != "acme" || seen.Get("X-Extracted") != "yes" {
+		t.Fatalf("Expected trace headers to be propagated, got %v", seen)
+	}
+	if seen.Get("X-Request-Id") != "explicit" || seen.Get("Authorization") != "" {
+		t.Fatalf("Expected explicit headers to win and others to stay out, got %v", seen)
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	var observed int
+	m := NewMetrics(func(host string, status int, latency time.Duration, err error) {
+		observed++
+	})
+	c, _ := New(WithLogger("empty"), WithMiddleware(MiddlewareMetrics, m.Middleware()))
+	c.Get(context.Background(), srv.URL, nil, nil)
+	c.Get(context.Background(), srv.URL+"/missing", nil, nil)
+	c.Get(context.Background(), "http://127.0.0.1:1", nil, nil)
+
+	stats := m.Stats()
+	s := stats[u.Host]
+	if s.Requests != 2 || s.Statuses[200] != 1 || s.Statuses[404] != 1 || s.Mean() < 5*time.Millisecond || s.Max < s.Mean() {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+	if stats["127.0.0.1:1"].Errors != 1 || observed != 3 {
+		t.Fatalf("Expected failed attempt to be recorded, got %+v %d", stats["127.0.0.1:1"], observed)
+	}
+	m.Reset()
+	if len(m.Stats()) != 0 {
+		t.Fatal("Expected stats to be cleared")
+	}
+}
@@ -0,0 +1,298 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MiddlewareOAuth2 - name of the middleware registered by WithOAuth2
+const MiddlewareOAuth2 = "oauth2"
+
+// OAuth2Config - token endpoint and credentials of a TokenSource
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Params - extra parameters of the token request, e.g. audience
+	Params url.Values
+	// RefreshToken - uses the refresh_token grant instead of client_credentials,
+	// refresh tokens returned by the endpoint replace it
+	RefreshToken string
+	// AuthInParams - sends the client credentials in the body instead of basic auth
+	AuthInParams bool
+	// ExpiryDelta - tokens are refreshed that long before they expire, defaults to 30s
+	ExpiryDelta time.Duration
+}
+
+// Token - access token returned by the token endpoint
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresIn    int64     `json:"expires_in,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	Expiry       time.Time `json:"-"`
+}
+
+// Type - token type for the Authorization header, defaults to Bearer
+func (t *Token) Type() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+// valid tells whether the token can still be used delta before it expires,
+// tokens without expiry are valid until rejected
+func (t *Token) valid(delta time.Duration) bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry))
+}
+
+// OAuth2Error - error returned by the token endpoint
+type OAuth2Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *OAuth2Error) Error() string {
+	msg := "oauth2 token request failed with status " + strconv.Itoa(e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Description != "" {
+		msg += " " + e.Description
+	}
+	return msg
+}
+
+// TokenSource - fetches, caches and refreshes access tokens, concurrent
+// callers share a single request to the token endpoint
+type TokenSource struct {
+	client  Client
+	cfg     OAuth2Config
+	mu      sync.Mutex
+	token   *Token
+	refresh string
+	call    *tokenCall
+}
+
+// tokenCall - token request in flight
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// NewTokenSource - creates a token source calling the token endpoint with c,
+// token requests bypass the middlewares of c so secrets stay out of the logs
+func NewTokenSource(c Client, cfg OAuth2Config) (*TokenSource, error) {
+	if cfg.TokenURL == "" {
+		return nil, errors.New("oauth2 token url missing")
+	}
+	if _, e := url.Parse(cfg.TokenURL); e != nil {
+		return nil, e
+	}
+	if cfg.ExpiryDelta <= 0 {
+		cfg.ExpiryDelta = 30 * time.Second
+	}
+	c.middlewares = nil
+	c.statusErrors = false
+	return &TokenSource{client: c, cfg: cfg, refresh: cfg.RefreshToken}, nil
+}
+
+// Token - returns the cached token, fetching a new one when it is about to expire
+func (ts *TokenSource) Token(ctx context.Context) (*Token, error) {
+	return ts.fetch(ctx, nil)
+}
+
+// Refresh - fetches a new token whatever the state of the cached one
+func (ts *TokenSource) Refresh(ctx context.Context) (*Token, error) {
+	ts.mu.Lock()
+	stale := ts.token
+	ts.mu.Unlock()
+	return ts.fetch(ctx, stale)
+}
+
+// fetch returns the cached token unless it expired or is the stale one, which
+// was rejected, and joins the request in flight if any
+func (ts *TokenSource) fetch(ctx context.Context, stale *Token) (*Token, error) {
+	ts.mu.Lock()
+	if ts.token.valid(ts.cfg.ExpiryDelta) && (stale == nil || ts.token != stale) {
+		token := ts.token
+		ts.mu.Unlock()
+		return token, nil
+	}
+	if call := ts.call; call != nil {
+		ts.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.token, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	ts.call = call
+	refresh := ts.refresh
+	ts.mu.Unlock()
+
+	call.token, call.err = ts.request(ctx, refresh)
+	var oe *OAuth2Error
+	if refresh != "" && ts.cfg.RefreshToken == "" && errors.As(call.err, &oe) && oe.Code == "invalid_grant" {
+		// the refresh token came with client credentials and expired, start over
+		refresh = ""
+		call.token, call.err = ts.request(ctx, refresh)
+	}
+
+	ts.mu.Lock()
+	ts.call = nil
+	if call.err == nil {
+		ts.token = call.token
+		ts.refresh = refresh
+		if call.token.RefreshToken != "" {
+			ts.refresh = call.token.RefreshToken
+		}
+	}
+	ts.mu.Unlock()
+	close(call.done)
+	return call.token, call.err
+}
+
+// request calls the token endpoint
+func (ts *TokenSource) request(ctx context.Context, refresh string) (*Token, error) {
+	cfg := ts.cfg
+	params := url.Values{}
+	for k, vs := range cfg.Params {
+		params[k] = append([]string(nil), vs...)
+	}
+	if refresh != "" {
+		params.Set("grant_type", "refresh_token")
+		params.Set("refresh_token", refresh)
+	} else {
+		params.Set("grant_type", "client_credentials")
+	}
+	if len(cfg.Scopes) > 0 {
+		params.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	r := ts.client.Request("POST", cfg.TokenURL).SetHeader("Accept", "application/json")
+	if cfg.AuthInParams {
+		params.Set("client_id", cfg.ClientID)
+		if cfg.ClientSecret != "" {
+			params.Set("client_secret", cfg.ClientSecret)
+		}
+	} else {
+		// credentials are form encoded before basic auth, RFC 6749 2.3.1
+		r.BasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+	res := r.Form(params).Stream(ctx)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	data, e := res.Bytes()
+	if e != nil {
+		return nil, e
+	}
+	body := map[string]interface{}{}
+	if strings.HasPrefix(res.Response.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		// some providers answer form encoded
+		values, _ := url.ParseQuery(string(data))
+		for k := range values {
+			body[k] = values.Get(k)
+		}
+	} else if e := json.Unmarshal(data, &body); e != nil && res.Response.StatusCode == http.StatusOK {
+		return nil, e
+	}
+	str := func(key string) string {
+		s, _ := body[key].(string)
+		return s
+	}
+	if res.Response.StatusCode != http.StatusOK || str("error") != "" {
+		return nil, &OAuth2Error{
+			StatusCode:  res.Response.StatusCode,
+			Code:        str("error"),
+			Description: str("error_description"),
+		}
+	}
+	token := &Token{
+		AccessToken:  str("access_token"),
+		TokenType:    str("token_type"),
+		RefreshToken: str("refresh_token"),
+		Scope:        str("scope"),
+	}
+	// json numbers and form encoded strings
+	switch v := body["expires_in"].(type) {
+	case float64:
+		token.ExpiresIn = int64(v)
+	case string:
+		token.ExpiresIn, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("oauth2 token response without access_token")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// Middleware - middleware setting the Authorization header, a 401 response
+// refreshes the token and retries the request once
+func (ts *TokenSource) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			token, e := ts.Token(ctx)
+			if e != nil {
+				return nil, e
+			}
+			resp, e := next.RoundTrip(authorize(req, token))
+			if e != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, e
+			}
+			if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+				// the body can't be sent again
+				return resp, nil
+			}
+			token, e = ts.fetch(ctx, token)
+			if e != nil {
+				// keep the 401, it tells more than the token error
+				return resp, nil
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			retry := authorize(req, token)
+			if req.GetBody != nil {
+				if retry.Body, e = req.GetBody(); e != nil {
+					return nil, e
+				}
+			}
+			return next.RoundTrip(retry)
+		})
+	}
+}
+
+// authorize copies the request with the token set
+func authorize(req *http.Request, token *Token) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+	return clone
+}
+
+// WithOAuth2 - authorizes every request with tokens of the config, see TokenSource
+func WithOAuth2(cfg OAuth2Config) Option {
+	return func(c *config) error {
+		c.oauth2 = &cfg
+		return nil
+	}
+}
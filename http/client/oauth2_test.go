@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer issues tok-1, tok-2... and only accepts the latest token
+type tokenServer struct {
+	issued  int32
+	grants  []string
+	mu      sync.Mutex
+	expires int
+	form    bool
+}
+
+func (ts *tokenServer) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			r.ParseForm()
+			id, secret, _ := r.BasicAuth()
+			// credentials are form encoded, RFC 6749 2.3.1
+			secret, _ = url.QueryUnescape(secret)
+			if id != "svc" || secret != "s3cr3t&" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+				return
+			}
+			grant := r.PostForm.Get("grant_type")
+			ts.mu.Lock()
+			ts.grants = append(ts.grants, grant+":"+r.PostForm.Get("refresh_token")+":"+r.PostForm.Get("scope"))
+			ts.mu.Unlock()
+			if grant == "refresh_token" && r.PostForm.Get("refresh_token") == "expired" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			// slow enough for concurrent callers to pile up
+			time.Sleep(20 * time.Millisecond)
+			n := atomic.AddInt32(&ts.issued, 1)
+			if ts.form {
+				w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+				fmt.Fprintf(w, "access_token=tok-%d&token_type=bearer&expires_in=%d", n, ts.expires)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"tok-%d","token_type":"Bearer","expires_in":%d,"refresh_token":"ref-%d"}`, n, ts.expires, n)
+		default:
+			if r.Header.Get("Authorization") != fmt.Sprintf("Bearer tok-%d", atomic.LoadInt32(&ts.issued)) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	ts := &tokenServer{expires: 3600}
+	srv := httptest.NewServer(ts.handler(t))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	source, err := NewTokenSource(c, OAuth2Config{
+		TokenURL:     srv.URL + "/token",
+		ClientID:     "svc",
+		ClientSecret: "s3cr3t&",
+		Scopes:       []string{"orders:read", "orders:write"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent callers share one token request
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, e := source.Token(context.Background()); e != nil || token.AccessToken != "tok-1" {
+				t.Errorf("Unexpected token %v %v", token, e)
+			}
+		}()
+	}
+	wg.Wait()
+	if ts.issued != 1 || ts.grants[0] != "client_credentials::orders:read orders:write" {
+		t.Fatalf("Expected a single client_credentials request, got %v", ts.grants)
+	}
+
+	// the returned refresh token is used once the token is refreshed
+	token, err := source.Refresh(context.Background())
+	if err != nil || token.AccessToken != "tok-2" || ts.grants[1] != "refresh_token:ref-1:orders:read orders:write" {
+		t.Fatalf("Expected refresh_token grant, got %v %v %v", token, err, ts.grants)
+	}
+	if token.Type() != "Bearer" || token.Expiry.Before(time.Now().Add(59*time.Minute)) {
+		t.Fatalf("Unexpected token %+v", token)
+	}
+
+	// invalid credentials surface the endpoint error
+	bad, _ := NewTokenSource(c, OAuth2Config{TokenURL: srv.URL + "/token", ClientID: "svc"})
+	var oe *OAuth2Error
+	if _, e := bad.Token(context.Background()); !errors.As(e, &oe) || oe.Code != "invalid_client" || oe.StatusCode != 401 {
+		t.Fatalf("Expected OAuth2Error, got %v", e)
+	}
+	if _, e := NewTokenSource(c, OAuth2Config{}); e == nil {
+		t.Fatal("Expected error without token url")
+	}
+}
+
+func TestTokenSourceExpiry(t *testing.T) {
+	// tokens expiring within the delta are refreshed on every call
+	ts := &tokenServer{expires: 10, form: true}
+	srv := httptest.NewServer(ts.handler(t))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	source, _ := NewTokenSource(c, OAuth2Config{TokenURL: srv.URL + "/token", ClientID: "svc", ClientSecret: "s3cr3t&"})
+	first, err := source.Token(context.Background())
+	if err != nil || first.ExpiresIn != 10 {
+		t.Fatalf("Unexpected form encoded token %+v %v", first, err)
+	}
+	second, _ := source.Token(context.Background())
+	if second.AccessToken == first.AccessToken {
+		t.Fatal("Expected token expiring within the delta to be refreshed")
+	}
+
+	// an expired refresh token falls back to client credentials
+	ts.expires = 3600
+	source, _ = NewTokenSource(c, OAuth2Config{TokenURL: srv.URL + "/token", ClientID: "svc", ClientSecret: "s3cr3t&"})
+	source.refresh = "expired"
+	if token, e := source.Token(context.Background()); e != nil || token.AccessToken == "" {
+		t.Fatalf("Expected client_credentials fallback, got %v", e)
+	}
+	// unless the refresh token was configured
+	source, _ = NewTokenSource(c, OAuth2Config{TokenURL: srv.URL + "/token", ClientID: "svc", ClientSecret: "s3cr3t&", RefreshToken: "expired"})
+	var oe *OAuth2Error
+	if _, e := source.Token(context.Background()); !errors.As(e, &oe) || oe.Code != "invalid_grant" {
+		t.Fatalf("Expected invalid_grant, got %v", e)
+	}
+}
+
+func TestOAuth2Middleware(t *testing.T) {
+	ts := &tokenServer{expires: 3600}
+	srv := httptest.NewServer(ts.handler(t))
+	defer srv.Close()
+
+	var logged []string
+	c, err := New(
+		WithLogger("empty"),
+		WithMiddleware(MiddlewareLogging, Logging(LoggingOptions{
+			Output: func(scope string, msg string) { logged = append(logged, msg) },
+		})),
+		WithOAuth2(OAuth2Config{TokenURL: srv.URL + "/token", ClientID: "svc", ClientSecret: "s3cr3t&"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := c.Get(context.Background(), srv.URL+"/orders", nil, nil)
+	if res.Error != nil || res.Response.StatusCode != 200 {
+		t.Fatalf("Expected authorized call, got %v %d", res.Error, res.Response.StatusCode)
+	}
+	if len(logged) != 1 {
+		t.Fatalf("Expected the token request to bypass the logging, got %v", logged)
+	}
+
+	// a token revoked upstream is refreshed and the request retried once
+	atomic.AddInt32(&ts.issued, 1)
+	res = c.Post(context.Background(), srv.URL+"/orders", []byte(`{"id":1}`), nil)
+	if res.Error != nil || res.Response.StatusCode != 200 || ts.issued != 3 {
+		t.Fatalf("Expected retry after refresh, got %v %d issued %d", res.Error, res.Response.StatusCode, ts.issued)
+	}
+}
@@ -0,0 +1,440 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Option - configures the client created by New
+type Option func(*config) error
+
+// config collects the options, defaults are set by defaultConfig
+type config struct {
+	transport           http.RoundTripper
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	keepAlive           time.Duration
+	disableKeepAlives   bool
+	timeouts            Timeouts
+	proxy               func(*http.Request) (*url.URL, error)
+	resolver            *net.Resolver
+	tls                 *tls.Config
+	unixSocket          string
+	logType             string
+	json                bool
+	retry               *RetryPolicy
+	breaker             *BreakerOptions
+	maxResponseSize     int64
+	statusErrors        bool
+	middlewares         []namedMiddleware
+	oauth2              *OAuth2Config
+	cache               *CacheOptions
+	http2               *HTTP2Options
+}
+
+// defaultConfig - production settings rather than the zero values of net/http,
+// which keep only 2 idle connections per host and have no dial or tls timeout
+func defaultConfig() *config {
+	return &config{
+		maxIdleConns:        100,
+		maxIdleConnsPerHost: 10,
+		keepAlive:           30 * time.Second,
+		timeouts: Timeouts{
+			Request:      TIMEOUT * time.Millisecond,
+			Dial:         10 * time.Second,
+			TLSHandshake: 10 * time.Second,
+			IdleConn:     90 * time.Second,
+		},
+		proxy: http.ProxyFromEnvironment,
+		tls:   &tls.Config{MinVersion: tls.VersionTLS12},
+		json:  true,
+	}
+}
+
+// buildTransport builds the transport with http/2 when enabled
+func (cfg *config) buildTransport() (*http.Transport, *net.Dialer, error) {
+	tr, dialer := cfg.newTransport()
+	if cfg.http2 != nil {
+		if e := cfg.http2.configure(tr); e != nil {
+			return nil, nil, e
+		}
+	}
+	return tr, dialer, nil
+}
+
+// newTransport builds the transport and returns its dialer
+func (cfg *config) newTransport() (*http.Transport, *net.Dialer) {
+	dialer := &net.Dialer{
+		Timeout:   cfg.timeouts.Dial,
+		KeepAlive: cfg.keepAlive,
+		Resolver:  cfg.resolver,
+	}
+	dial := dialContext(dialer)
+	if cfg.unixSocket != "" {
+		socket := cfg.unixSocket
+		dial = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			conn, e := dialer.DialContext(ctx, "unix", socket)
+			if e != nil {
+				return nil, &dialError{e}
+			}
+			return conn, nil
+		}
+	}
+	return &http.Transport{
+		Proxy:                 cfg.proxy,
+		DialContext:           dial,
+		TLSClientConfig:       cfg.tls,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.maxIdleConns,
+		MaxIdleConnsPerHost:   cfg.maxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.maxConnsPerHost,
+		DisableKeepAlives:     cfg.disableKeepAlives,
+		IdleConnTimeout:       cfg.timeouts.IdleConn,
+		TLSHandshakeTimeout:   cfg.timeouts.TLSHandshake,
+		ResponseHeaderTimeout: cfg.timeouts.ResponseHeader,
+		ExpectContinueTimeout: time.Second,
+	}, dialer
+}
+
+// WithMaxIdleConns - idle connections kept across all hosts, defaults to 100
+func WithMaxIdleConns(n int) Option {
+	return func(cfg *config) error {
+		cfg.maxIdleConns = n
+		return nil
+	}
+}
+
+// WithMaxIdleConnsPerHost - idle connections kept per host, defaults to 10
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(cfg *config) error {
+		cfg.maxIdleConnsPerHost = n
+		return nil
+	}
+}
+
+// WithMaxConnsPerHost - limits connections per host including active ones, 0 is unlimited
+func WithMaxConnsPerHost(n int) Option {
+	return func(cfg *config) error {
+		cfg.maxConnsPerHost = n
+		return nil
+	}
+}
+
+// WithKeepAlive - interval of tcp keep-alive probes, defaults to 30s, negative disables them
+func WithKeepAlive(d time.Duration) Option {
+	return func(cfg *config) error {
+		cfg.keepAlive = d
+		return nil
+	}
+}
+
+// WithoutKeepAlives - closes connections after every request instead of reusing them
+func WithoutKeepAlives() Option {
+	return func(cfg *config) error {
+		cfg.disableKeepAlives = true
+		return nil
+	}
+}
+
+// WithTimeouts - request and transport timeouts, zero values keep the defaults
+func WithTimeouts(t Timeouts) Option {
+	return func(cfg *config) error {
+		if t.Request > 0 {
+			cfg.timeouts.Request = t.Request
+		}
+		if t.Dial > 0 {
+			cfg.timeouts.Dial = t.Dial
+		}
+		if t.TLSHandshake > 0 {
+			cfg.timeouts.TLSHandshake = t.TLSHandshake
+		}
+		if t.ResponseHeader > 0 {
+			cfg.timeouts.ResponseHeader = t.ResponseHeader
+		}
+		if t.IdleConn > 0 {
+			cfg.timeouts.IdleConn = t.IdleConn
+		}
+		return nil
+	}
+}
+
+// WithProxy - custom proxy selection, by default HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY from the environment are used
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(cfg *config) error {
+		cfg.proxy = proxy
+		return nil
+	}
+}
+
+// WithProxyURL - sends every request through the proxy, an empty url disables proxies
+func WithProxyURL(proxy string) Option {
+	return WithProxyRules(ProxyRules{Default: proxy})
+}
+
+// ProxyRules - proxy selection per host
+type ProxyRules struct {
+	// Default - proxy for hosts without a rule, empty connects directly
+	Default string
+	// Hosts - proxy per host, "*.example.com" matches subdomains, an empty
+	// value connects directly
+	Hosts map[string]string
+	// NoProxy - hosts always connected directly, even when Hosts has a rule for
+	// them, same syntax as the NO_PROXY variable: "*", domains matching their
+	// subdomains, ips and cidr ranges
+	NoProxy []string
+}
+
+// WithProxyRules - selects the proxy per host
+func WithProxyRules(rules ProxyRules) Option {
+	return func(cfg *config) error {
+		proxy, e := rules.compile()
+		if e != nil {
+			return e
+		}
+		cfg.proxy = proxy
+		return nil
+	}
+}
+
+func (rules ProxyRules) compile() (func(*http.Request) (*url.URL, error), error) {
+	parse := func(raw string) (*url.URL, error) {
+		if raw == "" {
+			return nil, nil
+		}
+		if !strings.Contains(raw, "://") {
+			raw = "http://" + raw
+		}
+		return url.Parse(raw)
+	}
+	def, e := parse(rules.Default)
+	if e != nil {
+		return nil, e
+	}
+	hosts := map[string]*url.URL{}
+	for pattern, raw := range rules.Hosts {
+		u, e := parse(raw)
+		if e != nil {
+			return nil, e
+		}
+		hosts[strings.ToLower(pattern)] = u
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxy(req.URL, rules.NoProxy) {
+			return nil, nil
+		}
+		host := strings.ToLower(req.URL.Hostname())
+		if u, ok := hosts[host]; ok {
+			return u, nil
+		}
+		// the most specific wildcard wins
+		var match *url.URL
+		longest := 0
+		for pattern, u := range hosts {
+			if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) && len(pattern) > longest {
+				match, longest = u, len(pattern)
+			}
+		}
+		if longest > 0 {
+			return match, nil
+		}
+		return def, nil
+	}, nil
+}
+
+// noProxy matches the url against NO_PROXY style entries
+func noProxy(u *url.URL, entries []string) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	ip := net.ParseIP(host)
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, e := net.ParseCIDR(entry); e == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, p, e := net.SplitHostPort(entry); e == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		if ip != nil {
+			if entryIP := net.ParseIP(entry); entryIP != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, "*")
+		if strings.HasPrefix(entry, ".") {
+			if strings.HasSuffix(host, entry) {
+				return true
+			}
+			continue
+		}
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithResolver - custom dns resolver, e.g. pointing at a specific dns server
+func WithResolver(resolver *net.Resolver) Option {
+	return func(cfg *config) error {
+		cfg.resolver = resolver
+		return nil
+	}
+}
+
+// WithRootCAs - replaces the system certificate authorities
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(cfg *config) error {
+		cfg.tls.RootCAs = pool
+		return nil
+	}
+}
+
+// WithCAFile - trusts the pem encoded certificate authorities of the file on
+// top of the system ones
+func WithCAFile(path string) Option {
+	return func(cfg *config) error {
+		data, e := os.ReadFile(path)
+		if e != nil {
+			return e
+		}
+		pool := cfg.tls.RootCAs
+		if pool == nil {
+			if pool, e = x509.SystemCertPool(); e != nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New("no certificate found in " + path)
+		}
+		cfg.tls.RootCAs = pool
+		return nil
+	}
+}
+
+// WithClientCert - presents the certificate for mutual tls
+func WithClientCert(certFile string, keyFile string) Option {
+	return func(cfg *config) error {
+		cert, e := tls.LoadX509KeyPair(certFile, keyFile)
+		if e != nil {
+			return e
+		}
+		cfg.tls.Certificates = append(cfg.tls.Certificates, cert)
+		return nil
+	}
+}
+
+// WithTLSMinVersion - minimum tls version, defaults to tls.VersionTLS12
+func WithTLSMinVersion(version uint16) Option {
+	return func(cfg *config) error {
+		cfg.tls.MinVersion = version
+		return nil
+	}
+}
+
+// WithTLSConfig - replaces the tls config, options applied afterwards modify it
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(cfg *config) error {
+		cfg.tls = &tls.Config{}
+		if tlsConfig != nil {
+			cfg.tls = tlsConfig.Clone()
+		}
+		return nil
+	}
+}
+
+// WithUnixSocket - connects every request to the unix domain socket whatever
+// the host of the url, e.g. to talk to the docker daemon
+func WithUnixSocket(path string) Option {
+	return func(cfg *config) error {
+		cfg.unixSocket = path
+		return nil
+	}
+}
+
+// WithTransport - replaces the transport entirely, transport options are
+// ignored, handy to plug test doubles
+func WithTransport(transport http.RoundTripper) Option {
+	return func(cfg *config) error {
+		cfg.transport = transport
+		return nil
+	}
+}
+
+// WithLogger - logger mode, see SetLogger
+func WithLogger(logtype string) Option {
+	return func(cfg *config) error {
+		cfg.logType = logtype
+		return nil
+	}
+}
+
+// WithJSON - parse responses as json (default) or html, see SetJSON
+func WithJSON(enabled bool) Option {
+	return func(cfg *config) error {
+		cfg.json = enabled
+		return nil
+	}
+}
+
+// WithRetry - retry policy, see SetRetry
+func WithRetry(policy RetryPolicy) Option {
+	return func(cfg *config) error {
+		cfg.retry = &policy
+		return nil
+	}
+}
+
+// WithBreaker - per host circuit breaker, see SetBreaker
+func WithBreaker(opts BreakerOptions) Option {
+	return func(cfg *config) error {
+		cfg.breaker = &opts
+		return nil
+	}
+}
+
+// WithMaxResponseSize - limits response bodies, see SetMaxResponseSize
+func WithMaxResponseSize(size int64) Option {
+	return func(cfg *config) error {
+		cfg.maxResponseSize = size
+		return nil
+	}
+}
+
+// WithStatusErrors - non 2xx responses become a *StatusError, see SetStatusErrors
+func WithStatusErrors(enabled bool) Option {
+	return func(cfg *config) error {
+		cfg.statusErrors = enabled
+		return nil
+	}
+}
+
+// WithMiddleware - appends a middleware to the chain, see Use
+func WithMiddleware(name string, mw Middleware) Option {
+	return func(cfg *config) error {
+		cfg.middlewares = append(cfg.middlewares, namedMiddleware{name, mw})
+		return nil
+	}
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewDefaults(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tr, ok := c.Client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatal("Expected *http.Transport")
+	}
+	if tr.MaxIdleConnsPerHost != 10 || tr.MaxIdleConns != 100 || tr.TLSHandshakeTimeout != 10*time.Second ||
+		tr.IdleConnTimeout != 90*time.Second || tr.Proxy == nil || tr.TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("Unexpected default transport %+v", tr)
+	}
+	if c.timeout != TIMEOUT || !c.JSON || c.dialer.Timeout != 10*time.Second {
+		t.Fatal("Unexpected client defaults")
+	}
+
+	resolver := &net.Resolver{PreferGo: true}
+	c, err = New(
+		WithMaxIdleConns(10),
+		WithMaxIdleConnsPerHost(5),
+		WithMaxConnsPerHost(20),
+		WithoutKeepAlives(),
+		WithKeepAlive(-1),
+		WithResolver(resolver),
+		WithTLSMinVersion(tls.VersionTLS13),
+		WithTimeouts(Timeouts{Request: time.Second, Dial: time.Second, ResponseHeader: 2 * time.Second}),
+		WithJSON(false),
+		WithLogger("empty"),
+		WithRetry(RetryPolicy{MaxAttempts: 2}),
+		WithBreaker(BreakerOptions{}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tr = c.Client.Transport.(*http.Transport)
+	if tr.MaxIdleConns != 10 || tr.MaxIdleConnsPerHost != 5 || tr.MaxConnsPerHost != 20 || !tr.DisableKeepAlives ||
+		tr.ResponseHeaderTimeout != 2*time.Second || tr.TLSClientConfig.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("Unexpected transport %+v", tr)
+	}
+	if c.dialer.Resolver != resolver || c.dialer.KeepAlive != -1 || c.dialer.Timeout != time.Second {
+		t.Fatal("Unexpected dialer settings")
+	}
+	if c.timeout != 1000 || c.JSON || c.retry.MaxAttempts != 2 || c.breakers == nil {
+		t.Fatal("Unexpected client settings")
+	}
+
+	if _, err = New(WithCAFile("missing.pem")); err == nil {
+		t.Fatal("Expected error for missing ca file")
+	}
+	if _, err = New(WithProxyURL("http://[::1")); err == nil {
+		t.Fatal("Expected error for invalid proxy url")
+	}
+}
+
+func TestWithCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	if res := c.Get(context.Background(), srv.URL, nil, nil); res.Error == nil {
+		t.Fatal("Expected unknown authority error")
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(ca, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(WithLogger("empty"), WithCAFile(ca))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if res := c.Get(context.Background(), srv.URL, nil, nil); res.Error != nil {
+		t.Fatalf("Expected custom ca to be trusted, got %v", res.Error)
+	}
+}
+
+func TestWithUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"), WithUnixSocket(socket))
+	res := c.Get(context.Background(), "http://docker/v1/info", nil, nil)
+	if res.Error != nil || string(res.JSON) != `{"path":"/v1/info"}` {
+		t.Fatalf("Expected response over the unix socket, got %v %s", res.Error, res.JSON)
+	}
+}
+
+func TestProxyRules(t *testing.T) {
+	proxy, err := ProxyRules{
+		Default: "proxy.internal:3128",
+		Hosts: map[string]string{
+			"api.partner.com":    "http://partner-proxy:8080",
+			"*.partner.com":      "http://wildcard-proxy:8080",
+			"*.eu.partner.com":   "http://eu-proxy:8080",
+			"direct.partner.com": "",
+			"*.example.com":      "http://example-proxy:8080",
+			"10.0.0.5":           "http://ip-proxy:8080",
+		},
+		NoProxy: []string{"internal.partner.com", "localhost", ".svc.cluster.local", "10.0.0.0/8", "example.com", "192.168.1.1", "internal:8443"},
+	}.compile()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tests := []struct {
+		url    string
+		expect string
+	}{
+		{"https://api.partner.com/x", "http://partner-proxy:8080"},
+		{"https://www.partner.com", "http://wildcard-proxy:8080"},
+		{"https://a.eu.partner.com", "http://eu-proxy:8080"},
+		{"https://direct.partner.com", ""},
+		{"https://internal.partner.com", ""},
+		{"https://a.internal.partner.com", ""},
+		{"http://10.0.0.5", ""},
+		{"http://localhost:8080", ""},
+		{"http://orders.default.svc.cluster.local", ""},
+		{"http://10.1.2.3", ""},
+		{"http://example.com", ""},
+		{"http://www.example.com", ""},
+		{"http://notexample.com", "http://proxy.internal:3128"},
+		{"http://192.168.1.1", ""},
+		{"http://192.168.1.2", "http://proxy.internal:3128"},
+		{"https://internal:8443", ""},
+		{"https://internal:9443", "http://proxy.internal:3128"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		u, e := proxy(req)
+		if e != nil {
+			t.Errorf("%s: unexpected error %v", tt.url, e)
+			continue
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.expect {
+			t.Errorf("%s: expected proxy %q, got %q", tt.url, tt.expect, got)
+		}
+	}
+}
+
+func TestOptionError(t *testing.T) {
+	failing := func(cfg *config) error {
+		return errors.New("bad option")
+	}
+	if _, err := New(failing); err == nil {
+		t.Fatal("Expected option error to be returned")
+	}
+}
@@ -0,0 +1,399 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrBodySent - returned when a request whose body is a stream is sent again
+var ErrBodySent = errors.New("http client request body already sent")
+
+// Request - request builder returned by Client.Request, every method returns
+// the builder so calls can be chained and Do or Stream sends it
+type Request struct {
+	client  Client
+	method  string
+	url     string
+	query   url.Values
+	header  http.Header
+	cookies []*http.Cookie
+	body    func() (io.Reader, string, error)
+	parts   []part
+	timeout *time.Duration
+	without []string
+	err     error
+}
+
+// part - field or file of a multipart body
+type part struct {
+	field       string
+	value       string
+	filename    string
+	contentType string
+	reader      io.Reader
+}
+
+// Request - starts building a request, e.g.
+// c.Request("POST", url).Query("dry_run", "true").JSON(order).Do(ctx)
+func (c Client) Request(method string, rawURL string) *Request {
+	return &Request{
+		client: c,
+		method: strings.ToUpper(method),
+		url:    rawURL,
+		query:  url.Values{},
+		header: http.Header{},
+	}
+}
+
+// Query - adds query parameters to the url, existing ones are kept
+func (r *Request) Query(key string, values ...string) *Request {
+	for _, v := range values {
+		r.query.Add(key, v)
+	}
+	return r
+}
+
+// QueryValues - adds all the query parameters
+func (r *Request) QueryValues(values url.Values) *Request {
+	for k, vs := range values {
+		r.Query(k, vs...)
+	}
+	return r
+}
+
+// Header - adds values to the header, keeping the ones already set
+func (r *Request) Header(key string, values ...string) *Request {
+	for _, v := range values {
+		r.header.Add(key, v)
+	}
+	return r
+}
+
+// SetHeader - replaces the values of the header
+func (r *Request) SetHeader(key string, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// Headers - sets the headers, replacing values already set
+func (r *Request) Headers(hdr map[string]string) *Request {
+	for k, v := range hdr {
+		r.header.Set(k, v)
+	}
+	return r
+}
+
+// Cookie - adds a cookie to the request
+func (r *Request) Cookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// BasicAuth - sets basic authorization
+func (r *Request) BasicAuth(username string, password string) *Request {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return r.SetHeader("Authorization", "Basic "+auth)
+}
+
+// BearerAuth - sets bearer token authorization
+func (r *Request) BearerAuth(token string) *Request {
+	return r.SetHeader("Authorization", "Bearer "+token)
+}
+
+// Timeout - replaces the client timeout for this request, 0 disables it,
+// the deadline of the context still applies
+func (r *Request) Timeout(timeout time.Duration) *Request {
+	r.timeout = &timeout
+	return r
+}
+
+// Retry - replaces the client retry policy for this request, e.g. to opt a
+// POST in, RetryPolicy{} disables retries
+func (r *Request) Retry(policy RetryPolicy) *Request {
+	r.client.SetRetry(policy)
+	return r
+}
+
+// Without - skips the named middlewares for this request
+func (r *Request) Without(names ...string) *Request {
+	r.without = append(r.without, names...)
+	return r
+}
+
+// Body - sends the reader as is, the content of bytes.Reader, bytes.Buffer and
+// strings.Reader is kept so the request can be retried and sent again, other
+// readers are streamed once, never retried and sending again fails with ErrBodySent
+func (r *Request) Body(contentType string, body io.Reader) *Request {
+	r.parts = nil
+	var data []byte
+	replay := true
+	switch b := body.(type) {
+	case nil:
+	case *bytes.Reader:
+		// read a copy so the position of the caller's reader is kept
+		snapshot := *b
+		data, _ = io.ReadAll(&snapshot)
+	case *strings.Reader:
+		snapshot := *b
+		data, _ = io.ReadAll(&snapshot)
+	case *bytes.Buffer:
+		data = append([]byte(nil), b.Bytes()...)
+	default:
+		replay = false
+	}
+	sent := false
+	r.body = func() (io.Reader, string, error) {
+		if body == nil {
+			return nil, contentType, nil
+		}
+		if replay {
+			return bytes.NewReader(data), contentType, nil
+		}
+		if sent {
+			return nil, "", ErrBodySent
+		}
+		sent = true
+		return body, contentType, nil
+	}
+	return r
+}
+
+// JSON - sends v encoded as json, []byte and json.RawMessage are sent as is
+func (r *Request) JSON(v interface{}) *Request {
+	var data []byte
+	switch t := v.(type) {
+	case []byte:
+		data = t
+	case json.RawMessage:
+		data = t
+	default:
+		var e error
+		if data, e = json.Marshal(v); e != nil {
+			r.err = e
+			return r
+		}
+	}
+	return r.Body("application/json", bytes.NewReader(data))
+}
+
+// Form - sends the values url encoded
+func (r *Request) Form(values url.Values) *Request {
+	return r.Body("application/x-www-form-urlencoded", strings.NewReader(values.Encode()))
+}
+
+// Field - adds a field to the multipart body
+func (r *Request) Field(name string, value string) *Request {
+	return r.multipart(part{field: name, value: value})
+}
+
+// File - adds a file to the multipart body, the reader is streamed without
+// buffering and closed once sent when it is an io.Closer. Multipart bodies
+// can't be rewound so they are not retried, and with files they can only be
+// sent once, see Body
+func (r *Request) File(field string, filename string, reader io.Reader) *Request {
+	return r.FileWithType(field, filename, "application/octet-stream", reader)
+}
+
+// FileWithType - adds a file with its content type to the multipart body
+func (r *Request) FileWithType(field string, filename string, contentType string, reader io.Reader) *Request {
+	return r.multipart(part{field: field, filename: filename, contentType: contentType, reader: reader})
+}
+
+func (r *Request) multipart(p part) *Request {
+	r.parts = append(r.parts, p)
+	parts := r.parts
+	files := false
+	for _, p := range parts {
+		files = files || p.reader != nil
+	}
+	sent := false
+	r.body = func() (io.Reader, string, error) {
+		if files && sent {
+			return nil, "", ErrBodySent
+		}
+		sent = true
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		go func() {
+			pw.CloseWithError(writeParts(mw, parts))
+		}()
+		return pr, mw.FormDataContentType(), nil
+	}
+	return r
+}
+
+// writeParts writes the multipart body, the pipe reader gets the error if any
+func writeParts(mw *multipart.Writer, parts []part) error {
+	for _, p := range parts {
+		if p.reader == nil {
+			if e := mw.WriteField(p.field, p.value); e != nil {
+				return e
+			}
+			continue
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+escapeQuotes(p.field)+`"; filename="`+escapeQuotes(p.filename)+`"`)
+		h.Set("Content-Type", p.contentType)
+		w, e := mw.CreatePart(h)
+		if e != nil {
+			return e
+		}
+		_, e = io.Copy(w, p.reader)
+		if closer, ok := p.reader.(io.Closer); ok {
+			closer.Close()
+		}
+		if e != nil {
+			return e
+		}
+	}
+	return mw.Close()
+}
+
+func escapeQuotes(s string) string {
+	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(s)
+}
+
+// Do - sends the request and parses the response as the client is configured,
+// json or html, HEAD responses are not parsed
+func (r *Request) Do(ctx context.Context) Res {
+	// the client timeout applies on top of the caller's deadline
+	ctx, cancel := r.client.withTimeout(r.context(ctx))
+	defer cancel()
+
+	res := r.send(ctx)
+	if res.Error != nil {
+		return res
+	}
+	switch {
+	case r.method == http.MethodHead:
+		res.bytes()
+	case r.client.JSON:
+		res.JSONparse()
+	default:
+		res.HTMLparse()
+	}
+	r.client.statusError(&res)
+	return res
+}
+
+// Stream - sends the request and returns the body unread in Res.Response.Body,
+// which the caller must close (or read through Decode, Lines or NDJSON). The
+// timeout covers reading the body too, use Timeout(0) for long downloads
+func (r *Request) Stream(ctx context.Context) Res {
+	ctx, cancel := r.client.withTimeout(r.context(ctx))
+	res := r.send(ctx)
+	if res.Error != nil {
+		cancel()
+		return res
+	}
+	res.Response.Body = &cancelBody{ReadCloser: res.Response.Body, cancel: cancel}
+	if r.client.statusErrors && !success(res.Response.StatusCode) {
+		// error bodies are small, read them so the error carries them
+		if _, e := res.bytes(); e != nil {
+			res.Error = e
+		}
+		r.client.statusError(&res)
+	}
+	return res
+}
+
+// context applies the timeout of the request
+func (r *Request) context(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if r.timeout != nil {
+		ctx = OverrideTimeout(ctx, *r.timeout)
+	}
+	if len(r.without) > 0 {
+		ctx = WithoutMiddleware(ctx, r.without...)
+	}
+	return ctx
+}
+
+// build creates the http request
+func (r *Request) build(ctx context.Context) (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	u, e := url.Parse(r.url)
+	if e != nil {
+		return nil, e
+	}
+	if len(r.query) > 0 {
+		q := u.Query()
+		for k, vs := range r.query {
+			q[k] = append(q[k], vs...)
+		}
+		u.RawQuery = q.Encode()
+	}
+	var body io.Reader
+	contentType := ""
+	if r.body != nil {
+		if body, contentType, e = r.body(); e != nil {
+			return nil, e
+		}
+	}
+	req, e := http.NewRequestWithContext(ctx, r.method, u.String(), body)
+	if e != nil {
+		return nil, e
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// headers of the caller win over the body content type
+	for k, vs := range r.header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+	return req, nil
+}
+
+// send makes the call and returns the response with the body still open,
+// decompressed and limited to the max response size
+func (r *Request) send(ctx context.Context) Res {
+	c := r.client
+	var res Res
+	res.log = c.log
+	req, e := r.build(ctx)
+	if e != nil {
+		c.log.Error("HTTPC_NEW", e)
+		res.Error = e
+		return res
+	}
+	// when the caller asks for an encoding the body is returned as is
+	decompress := req.Header.Get("Accept-Encoding") == "" && req.Method != http.MethodHead
+	if decompress {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	var resp *http.Response
+	if c.cache != nil {
+		resp, res.Cache, e = c.cache.do(c, req)
+	} else {
+		resp, e = c.do(req)
+	}
+	if e != nil {
+		c.log.Error("HTTPC_DO", e)
+		res.Error = e
+		return res
+	}
+	res.Response = *resp
+	if e := c.wrapBody(&res.Response, decompress); e != nil {
+		c.log.Error("HTTPC_BODY", e)
+		res.Error = e
+	}
+	return res
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	var last *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		last, body = r, string(data)
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+
+	// GET shortcuts no longer claim a json body
+	c.Get(context.Background(), srv.URL, nil, nil)
+	if last.Header.Get("Content-Type") != "" {
+		t.Fatalf("Expected no Content-Type on GET, got %s", last.Header.Get("Content-Type"))
+	}
+	c.Post(context.Background(), srv.URL, []byte(`{"a":1}`), nil)
+	if last.Header.Get("Content-Type") != "application/json" || body != `{"a":1}` {
+		t.Fatalf("Expected json body, got %s %s", last.Header.Get("Content-Type"), body)
+	}
+
+	res := c.Request("post", srv.URL+"?page=1").
+		Query("tag", "a", "b").
+		QueryValues(url.Values{"page": {"2"}}).
+		Header("X-Trace", "one", "two").
+		Headers(map[string]string{"X-Tenant": "acme"}).
+		Cookie(&http.Cookie{Name: "session", Value: "abc"}).
+		BasicAuth("user", "secret").
+		JSON(map[string]int{"id": 7}).
+		Do(context.Background())
+	if res.Error != nil {
+		t.Fatalf("Unexpected error %v", res.Error)
+	}
+	q := last.URL.Query()
+	if last.Method != "POST" || strings.Join(q["page"], ",") != "1,2" || strings.Join(q["tag"], ",") != "a,b" {
+		t.Fatalf("Unexpected url %s %s", last.Method, last.URL)
+	}
+	if strings.Join(last.Header.Values("X-Trace"), ",") != "one,two" || last.Header.Get("X-Tenant") != "acme" {
+		t.Fatalf("Unexpected headers %v", last.Header)
+	}
+	if cookie, e := last.Cookie("session"); e != nil || cookie.Value != "abc" {
+		t.Fatalf("Expected session cookie, got %v", e)
+	}
+	if user, pass, ok := last.BasicAuth(); !ok || user != "user" || pass != "secret" {
+		t.Fatal("Expected basic auth")
+	}
+	if body != `{"id":7}` || last.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected json body %s", body)
+	}
+
+	c.Request("PUT", srv.URL).BearerAuth("token").Form(url.Values{"name": {"a b"}}).Do(context.Background())
+	if last.Header.Get("Authorization") != "Bearer token" || body != "name=a+b" ||
+		last.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Fatalf("Unexpected form request %v %s", last.Header, body)
+	}
+
+	// the caller's header wins over the body content type
+	c.Request("POST", srv.URL).Body("text/plain", strings.NewReader("hi")).SetHeader("Content-Type", "text/csv").Do(context.Background())
+	if last.Header.Get("Content-Type") != "text/csv" || body != "hi" {
+		t.Fatalf("Unexpected raw body %v %s", last.Header, body)
+	}
+
+	if res := c.Head(context.Background(), srv.URL, nil); res.Error != nil || last.Method != "HEAD" {
+		t.Fatalf("Unexpected HEAD result %v", res.Error)
+	}
+	if res := c.Options(context.Background(), srv.URL, nil); res.Error != nil || last.Method != "OPTIONS" {
+		t.Fatalf("Unexpected OPTIONS result %v", res.Error)
+	}
+
+	if res := c.Request("POST", srv.URL).JSON(func() {}).Do(context.Background()); res.Error == nil {
+		t.Fatal("Expected json encoding error")
+	}
+}
+
+func TestRequestMultipart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e := r.ParseMultipartForm(1 << 20); e != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f, h, e := r.FormFile("upload")
+		if e != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		w.Write([]byte(`{"name":"` + r.FormValue("name") + `","file":"` + h.Filename + `","type":"` +
+			h.Header.Get("Content-Type") + `","data":"` + string(data) + `"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	// a pipe proves the file is streamed rather than buffered upfront
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("col1,col2"))
+		pw.Close()
+	}()
+	res := c.Request("POST", srv.URL).
+		Field("name", "report").
+		FileWithType("upload", "report.csv", "text/csv", pr).
+		Do(context.Background())
+	expect := `{"name":"report","file":"report.csv","type":"text/csv","data":"col1,col2"}`
+	if res.Error != nil || string(res.JSON) != expect {
+		t.Fatalf("Unexpected multipart result %v %s", res.Error, res.JSON)
+	}
+}
+
+func TestRequestRetryAndTimeout(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	// POST is only retried once the request opts in
+	res := c.Request("POST", srv.URL).
+		JSON(map[string]string{"a": "b"}).
+		Retry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, NonIdempotent: true}).
+		Do(context.Background())
+	if res.Error != nil || res.Response.StatusCode != http.StatusOK || calls != 2 {
+		t.Fatalf("Expected retried POST, got %v after %d calls", res.Error, calls)
+	}
+	if c.retry.MaxAttempts != 0 {
+		t.Fatal("Expected the client policy to stay untouched")
+	}
+
+	res = c.Request("GET", srv.URL).Query("slow", "1").Timeout(10 * time.Millisecond).Do(context.Background())
+	if !errors.Is(res.Error, ErrRequestTimeout) {
+		t.Fatalf("Expected request timeout, got %v", res.Error)
+	}
+}
+
+func TestRequestBodyReplay(t *testing.T) {
+	var calls int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	// the body is sent again on retries and on every Do of the builder
+	req := c.Request("POST", srv.URL).
+		Body("text/plain", strings.NewReader("hi")).
+		Retry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, NonIdempotent: true})
+	req.Do(context.Background())
+	if res := req.Do(context.Background()); res.Error != nil {
+		t.Fatalf("Unexpected error sending the request again %v", res.Error)
+	}
+	if strings.Join(bodies, ",") != "hi,hi,hi" {
+		t.Fatalf("Expected the body on every attempt, got %q", bodies)
+	}
+
+	// streams are sent once
+	bodies = nil
+	stream := c.Request("POST", srv.URL).Body("text/plain", io.MultiReader(strings.NewReader("once")))
+	if res := stream.Do(context.Background()); res.Error != nil || bodies[0] != "once" {
+		t.Fatalf("Unexpected stream result %v %q", res.Error, bodies)
+	}
+	if res := stream.Do(context.Background()); !errors.Is(res.Error, ErrBodySent) || len(bodies) != 1 {
+		t.Fatalf("Expected ErrBodySent, got %v", res.Error)
+	}
+}
@@ -2,8 +2,15 @@ package client
 
 import (
 	"io"
+	"bufio"
 	"bytes"
+	"errors"
+	"mime"
+	"net/url"
 	"net/http"
+	"strconv"
+	"strings"
+	"encoding/xml"
 	"encoding/json"
 	"github.com/kelchy/go-lib/log"
 )
@@ -15,21 +22,23 @@ type Res struct {
 	log		log.Log
 	HTML		string
 	JSON		json.RawMessage
+	body		[]byte
+	buffered	bool
+	// Cache - how the response cache served the response, empty without cache
+	Cache		CacheStatus
 }
 
 // HTMLparse - method to return the html content of response
 func (r *Res) HTMLparse() {
-	var data bytes.Buffer
 	if r.Error != nil {
 		return
 	}
-	defer r.Response.Body.Close()
-	_, e := io.Copy(&data, r.Response.Body)
+	data, e := r.bytes()
 	if e != nil {
 		r.Error = e
 		return
 	}
-	r.HTML = data.String()
+	r.HTML = string(data)
 }
 
 // JSONparse - method to return the json content of response
@@ -38,11 +47,197 @@ func (r *Res) JSONparse() {
 	if r.Error != nil {
 		return
 	}
-	defer r.Response.Body.Close()
-	e := json.NewDecoder(r.Response.Body).Decode(&data)
+	body, e := r.bytes()
+	if e != nil {
+		r.Error = e
+		return
+	}
+	e = json.NewDecoder(bytes.NewReader(body)).Decode(&data)
 	if e != nil {
 		r.Error = e
 		return
 	}
 	r.JSON = data
 }
+
+// Bytes - returns the raw body, reading it first for streamed responses
+func (r *Res) Bytes() ([]byte, error) {
+	if r.Error != nil && !r.buffered {
+		return nil, r.Error
+	}
+	return r.bytes()
+}
+
+// Close - closes the body of a streamed response, safe to call on any response
+func (r *Res) Close() error {
+	if r.buffered || r.Response.Body == nil {
+		return nil
+	}
+	return r.Response.Body.Close()
+}
+
+// Decode - decodes the body into v according to the content type: json (the
+// default), xml, form into *url.Values or *map[string]string and text into
+// *string. *[]byte and *string receive any body as is. Streamed responses are
+// decoded without buffering and closed. The body stays available when
+// JSONparse failed, non 2xx responses return the *StatusError instead
+func (r *Res) Decode(v interface{}) error {
+	if e := r.decodable(); e != nil {
+		return e
+	}
+	body, done := r.reader()
+	defer done()
+	return decode(r.Response.Header.Get("Content-Type"), body, v)
+}
+
+// Lines - calls fn for every line of the body without the line ending,
+// stopping at the first error, streamed responses are read as they arrive
+func (r *Res) Lines(fn func(line []byte) error) error {
+	if e := r.decodable(); e != nil {
+		return e
+	}
+	body, done := r.reader()
+	defer done()
+	reader := bufio.NewReader(body)
+	for {
+		line, e := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+		if e == io.EOF {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+	}
+}
+
+// NDJSON - calls fn for every json value of a newline delimited json body,
+// blank lines are skipped and an invalid line stops with an error
+func (r *Res) NDJSON(fn func(value json.RawMessage) error) error {
+	n := 0
+	return r.Lines(func(line []byte) error {
+		n++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			return nil
+		}
+		if !json.Valid(line) {
+			return errors.New("invalid json on line " + strconv.Itoa(n))
+		}
+		return fn(json.RawMessage(line))
+	})
+}
+
+// decodable returns the error preventing the body from being decoded
+func (r *Res) decodable() error {
+	if r.Error == nil {
+		return nil
+	}
+	var se *StatusError
+	if !r.buffered || errors.As(r.Error, &se) {
+		return r.Error
+	}
+	// JSONparse failed but the body was read
+	return nil
+}
+
+// reader returns the body and a func to call once done with it
+func (r *Res) reader() (io.Reader, func()) {
+	if r.buffered || r.Response.Body == nil {
+		return bytes.NewReader(r.body), func() {}
+	}
+	body := r.Response.Body
+	return body, func() {
+		// drain what is left so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(body, 4096))
+		body.Close()
+	}
+}
+
+// bytes reads the whole body once and keeps it for the other helpers
+func (r *Res) bytes() ([]byte, error) {
+	if r.buffered {
+		return r.body, nil
+	}
+	if r.Response.Body == nil {
+		r.buffered = true
+		return nil, nil
+	}
+	defer r.Response.Body.Close()
+	data, e := io.ReadAll(r.Response.Body)
+	if e != nil {
+		return nil, e
+	}
+	r.body, r.buffered = data, true
+	r.Response.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// StatusError - returned for non 2xx responses when status errors are enabled
+type StatusError struct {
+	StatusCode	int
+	Status		string
+	Header		http.Header
+	Body		[]byte
+}
+
+func (e *StatusError) Error() string {
+	msg := "http client unexpected status " + strconv.Itoa(e.StatusCode)
+	if len(e.Body) > 0 && len(e.Body) <= 256 {
+		msg += ": " + strings.TrimSpace(string(e.Body))
+	}
+	return msg
+}
+
+// Decode - decodes the error body according to its content type, see Res.Decode
+func (e *StatusError) Decode(v interface{}) error {
+	return decode(e.Header.Get("Content-Type"), bytes.NewReader(e.Body), v)
+}
+
+// decode picks the decoder from the content type
+func decode(contentType string, body io.Reader, v interface{}) error {
+	switch t := v.(type) {
+	case *[]byte:
+		data, e := io.ReadAll(body)
+		*t = data
+		return e
+	case *string:
+		data, e := io.ReadAll(body)
+		*t = string(data)
+		return e
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return xml.NewDecoder(body).Decode(v)
+	case mediaType == "application/x-www-form-urlencoded":
+		data, e := io.ReadAll(body)
+		if e != nil {
+			return e
+		}
+		values, e := url.ParseQuery(string(data))
+		if e != nil {
+			return e
+		}
+		switch t := v.(type) {
+		case *url.Values:
+			*t = values
+		case *map[string]string:
+			*t = make(map[string]string, len(values))
+			for k := range values {
+				(*t)[k] = values.Get(k)
+			}
+		default:
+			return errors.New("form body decodes into *url.Values or *map[string]string")
+		}
+		return nil
+	case strings.HasPrefix(mediaType, "text/") && mediaType != "text/json":
+		return errors.New("text body decodes into *string or *[]byte")
+	}
+	return json.NewDecoder(body).Decode(v)
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetryStatuses - response statuses retried when RetryPolicy.Statuses is empty
+var DefaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy - retry behaviour of the client, the zero value disables retries
+type RetryPolicy struct {
+	// MaxAttempts - total attempts including the first one, 0 or 1 disables retries
+	MaxAttempts int
+	// BaseDelay - delay before the first retry, doubled on every attempt with
+	// jitter, defaults to 100ms
+	BaseDelay time.Duration
+	// MaxDelay - upper bound of a single delay, defaults to 10s, a Retry-After
+	// longer than this stops retrying
+	MaxDelay time.Duration
+	// Statuses - response statuses retried, defaults to DefaultRetryStatuses
+	Statuses []int
+	// NonIdempotent - also retry POST and PATCH, requests carrying an
+	// Idempotency-Key header are retried regardless
+	NonIdempotent bool
+}
+
+// SetRetry - changes the retry policy, connection errors and the policy statuses
+// are retried for idempotent methods
+func (c *Client) SetRetry(policy RetryPolicy) {
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = 100 * time.Millisecond
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = 10 * time.Second
+	}
+	if len(policy.Statuses) == 0 {
+		policy.Statuses = DefaultRetryStatuses
+	}
+	c.retry = policy
+}
+
+// do sends the request, retrying it according to the retry policy, the body is
+// rewound between attempts and responses of failed attempts are discarded
+func (c Client) do(req *http.Request) (*http.Response, error) {
+	p := c.retry
+	attempts := 1
+	if p.MaxAttempts > 1 && p.allowed(req) {
+		attempts = p.MaxAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, e := req.GetBody()
+			if e != nil {
+				return nil, e
+			}
+			req.Body = body
+		}
+		resp, e := c.attempt(req)
+		if errors.Is(e, ErrCircuitOpen) {
+			return nil, e
+		}
+		if attempts > 1 {
+			c.log.Out("HTTPC_ATTEMPT", fmt.Sprintf("%s %s attempt %d/%d: %s", req.Method, req.URL.Redacted(), attempt, attempts, outcome(resp, e)))
+		}
+		if attempt >= attempts || !p.retryable(req, resp, e) {
+			return resp, e
+		}
+		wait, ok := p.delay(attempt, resp)
+		if deadline, set := req.Context().Deadline(); set && time.Until(deadline) < wait {
+			ok = false
+		}
+		if !ok {
+			return resp, e
+		}
+		if resp != nil {
+			// drain so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request once through the circuit breaker of its host
+func (c Client) attempt(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if c.breakers == nil {
+		resp, e := c.roundTrip(req)
+		return resp, timeoutError(ctx, e)
+	}
+	host := req.URL.Host
+	a, t, e := c.breakers.allow(host)
+	c.notify(t)
+	if e != nil {
+		return nil, e
+	}
+	resp, e := c.roundTrip(req)
+	// cancellations by the caller say nothing about the health of the host
+	c.notify(c.breakers.record(host, a, resp, e, e != nil && errors.Is(ctx.Err(), context.Canceled)))
+	return resp, timeoutError(ctx, e)
+}
+
+// allowed tells whether the method may be retried at all
+func (p RetryPolicy) allowed(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// the body can't be rewound
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return p.NonIdempotent || req.Header.Get("Idempotency-Key") != "" || req.Context().Value(idempotentKey{}) != nil
+}
+
+// idempotentKey marks requests safe to retry whatever their method, e.g.
+// GraphQL queries
+type idempotentKey struct{}
+
+// retryable tells whether the outcome of an attempt is worth retrying
+func (p RetryPolicy) retryable(req *http.Request, resp *http.Response, e error) bool {
+	if e != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		var invalid x509.CertificateInvalidError
+		return !errors.As(e, &unknownAuthority) && !errors.As(e, &hostname) && !errors.As(e, &invalid)
+	}
+	for _, s := range p.Statuses {
+		if resp.StatusCode == s {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the next attempt, Retry-After takes
+// precedence over the exponential backoff, false stops retrying
+func (p RetryPolicy) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait, wait <= p.MaxDelay
+		}
+	}
+	backoff := p.BaseDelay << uint(attempt-1)
+	if backoff <= 0 || backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	// equal jitter keeps at least half of the backoff
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an http date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, e := strconv.Atoi(value); e == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, e := http.ParseTime(value); e == nil {
+		wait := time.Until(t)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func outcome(resp *http.Response, e error) string {
+	if e != nil {
+		return e.Error()
+	}
+	return resp.Status
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New()
+	c.SetLogger("empty")
+	c.SetRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	res := c.Put(context.Background(), srv.URL, []byte(`{"a":1}`), nil)
+	if res.Error != nil || res.Response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected success after retries, got %v %d", res.Error, res.Response.StatusCode)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", calls)
+	}
+	for _, b := range bodies {
+		if b != `{"a":1}` {
+			t.Fatalf("Expected body to be rewound, got %q", b)
+		}
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c, _ := New()
+	c.SetLogger("empty")
+	c.SetJSON(false)
+	c.SetRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	res := c.Post(context.Background(), srv.URL, []byte(`{}`), nil)
+	if res.Response.StatusCode != http.StatusBadGateway || calls != 1 {
+		t.Fatalf("Expected a single POST attempt, got %d", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	c.Post(context.Background(), srv.URL, []byte(`{}`), map[string]string{"Idempotency-Key": "k1"})
+	if calls != 3 {
+		t.Fatalf("Expected POST with Idempotency-Key to be retried, got %d", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	c.SetRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, NonIdempotent: true})
+	c.Post(context.Background(), srv.URL, []byte(`{}`), nil)
+	if calls != 2 {
+		t.Fatalf("Expected POST to be retried once opted in, got %d", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New()
+	c.SetLogger("empty")
+	// Retry-After above MaxDelay stops retrying
+	c.SetRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 100 * time.Millisecond})
+	res := c.Get(context.Background(), srv.URL, nil, nil)
+	if res.Response.StatusCode != http.StatusTooManyRequests || calls != 1 {
+		t.Fatalf("Expected no retry when Retry-After exceeds MaxDelay, got %d", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	c.SetRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	start := time.Now()
+	res = c.Get(context.Background(), srv.URL, nil, nil)
+	if res.Response.StatusCode != http.StatusOK || time.Since(start) < time.Second {
+		t.Fatalf("Expected Retry-After to be honoured, got %d after %s", res.Response.StatusCode, time.Since(start))
+	}
+}
+
+func TestRetryConnectionError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	c, _ := New()
+	c.SetLogger("empty")
+	c.SetRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	start := time.Now()
+	res := c.Get(context.Background(), url, nil, nil)
+	if res.Error == nil {
+		t.Fatal("Expected connection error")
+	}
+	if time.Since(start) < time.Millisecond {
+		t.Fatal("Expected backoff between attempts")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c.SetRetry(RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second})
+	start = time.Now()
+	res = c.Get(ctx, url, nil, nil)
+	if res.Error == nil || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("Expected retries to stop at the context deadline, took %s", time.Since(start))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		wait, ok := p.delay(attempt+1, nil)
+		max *= time.Millisecond
+		if !ok || wait < max/2 || wait > max {
+			t.Errorf("attempt %d: expected delay within [%s, %s], got %s", attempt+1, max/2, max, wait)
+		}
+	}
+	if wait, ok := retryAfter("2"); !ok || wait != 2*time.Second {
+		t.Errorf("Expected 2s Retry-After, got %s", wait)
+	}
+	date := time.Now().Add(3 * time.Second).UTC().Format(http.TimeFormat)
+	if wait, ok := retryAfter(date); !ok || wait <= time.Second || wait > 3*time.Second {
+		t.Errorf("Expected http date Retry-After, got %s", wait)
+	}
+	if _, ok := retryAfter("soon"); ok {
+		t.Error("Expected invalid Retry-After to be ignored")
+	}
+}
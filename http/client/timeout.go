@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Timeouts - timeouts of the client, zero values keep the current setting
+type Timeouts struct {
+	// Request - deadline of a whole call including retries, always applied on
+	// top of the caller's context so the earliest deadline wins, defaults to TIMEOUT
+	Request time.Duration
+	// Dial - establishing the connection, defaults to 10s
+	Dial time.Duration
+	// TLSHandshake - defaults to 10s
+	TLSHandshake time.Duration
+	// ResponseHeader - waiting for the response headers once the request is
+	// written, by default only the request timeout applies
+	ResponseHeader time.Duration
+	// IdleConn - how long idle keep-alive connections are kept, defaults to 90s
+	IdleConn time.Duration
+}
+
+// timeout phases reported by TimeoutError
+const (
+	TimeoutDial           = "dial"
+	TimeoutTLSHandshake   = "tls_handshake"
+	TimeoutResponseHeader = "response_header"
+	TimeoutRequest        = "request"
+)
+
+// sentinel errors matched by TimeoutError with errors.Is
+var (
+	ErrDialTimeout           = errors.New("http client dial timeout")
+	ErrTLSHandshakeTimeout   = errors.New("http client tls handshake timeout")
+	ErrResponseHeaderTimeout = errors.New("http client response header timeout")
+	ErrRequestTimeout        = errors.New("http client request timeout")
+)
+
+// TimeoutError - returned when a call times out, Phase tells which timeout fired
+type TimeoutError struct {
+	Phase string
+	Err   error
+}
+
+func (e *TimeoutError) Error() string {
+	return e.sentinel().Error() + ": " + e.Err.Error()
+}
+
+// Unwrap - returns the underlying error
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout - satisfies net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Is - matches the sentinel of the phase, e.g. errors.Is(e, ErrDialTimeout)
+func (e *TimeoutError) Is(target error) bool {
+	return target == e.sentinel()
+}
+
+func (e *TimeoutError) sentinel() error {
+	switch e.Phase {
+	case TimeoutDial:
+		return ErrDialTimeout
+	case TimeoutTLSHandshake:
+		return ErrTLSHandshakeTimeout
+	case TimeoutResponseHeader:
+		return ErrResponseHeaderTimeout
+	}
+	return ErrRequestTimeout
+}
+
+type timeoutKey struct{}
+
+// OverrideTimeout - returns a context replacing the client request timeout for
+// calls made with it, the deadline of ctx itself still applies
+func OverrideTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// SetTimeouts - changes the request timeout and the transport timeouts, the
+// latter only apply to transports created by this package: a new transport is
+// built and swapped in, calls in flight finish on the previous one. Like the
+// other setters, call it before the client is shared
+func (c *Client) SetTimeouts(t Timeouts) {
+	if t.Request > 0 {
+		c.timeout = int(t.Request / time.Millisecond)
+	}
+	if t.Dial <= 0 && t.TLSHandshake <= 0 && t.ResponseHeader <= 0 && t.IdleConn <= 0 {
+		return
+	}
+	// the transport may have been replaced through the exported Client field
+	if c.transportCfg == nil || c.Client == nil || c.Client.Transport != c.transport {
+		return
+	}
+	cfg := *c.transportCfg
+	if t.Dial > 0 {
+		cfg.timeouts.Dial = t.Dial
+	}
+	if t.TLSHandshake > 0 {
+		cfg.timeouts.TLSHandshake = t.TLSHandshake
+	}
+	if t.ResponseHeader > 0 {
+		cfg.timeouts.ResponseHeader = t.ResponseHeader
+	}
+	if t.IdleConn > 0 {
+		cfg.timeouts.IdleConn = t.IdleConn
+	}
+	tr, dialer, e := cfg.buildTransport()
+	if e != nil {
+		c.log.Error("HTTPC_TIMEOUTS", e)
+		return
+	}
+	// the http.Client may be shared with copies of c, it is copied too
+	old := c.transport
+	hc := *c.Client
+	hc.Transport = tr
+	c.Client, c.dialer, c.transport, c.transportCfg = &hc, dialer, tr, &cfg
+	old.CloseIdleConnections()
+}
+
+// withTimeout applies the per request override or the client timeout to ctx
+func (c Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := time.Duration(c.timeout) * time.Millisecond
+	if d, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dialError marks errors coming from the dialer so dial timeouts can be told apart
+type dialError struct {
+	error
+}
+
+func (e *dialError) Unwrap() error {
+	return e.error
+}
+
+func dialContext(d *net.Dialer) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, e := d.DialContext(ctx, network, addr)
+		if e != nil {
+			return nil, &dialError{e}
+		}
+		return conn, nil
+	}
+}
+
+// timeoutError turns timeouts into a TimeoutError of the right phase, other
+// errors are returned unchanged
+func timeoutError(ctx context.Context, e error) error {
+	if e == nil {
+		return nil
+	}
+	var te *TimeoutError
+	if errors.As(e, &te) {
+		return e
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Phase: TimeoutRequest, Err: e}
+	}
+	var ne net.Error
+	if !errors.As(e, &ne) || !ne.Timeout() {
+		return e
+	}
+	var de *dialError
+	switch {
+	case errors.As(e, &de):
+		return &TimeoutError{Phase: TimeoutDial, Err: e}
+	case strings.Contains(e.Error(), "TLS handshake timeout"):
+		return &TimeoutError{Phase: TimeoutTLSHandshake, Err: e}
+	case strings.Contains(e.Error(), "timeout awaiting response headers"):
+		return &TimeoutError{Phase: TimeoutResponseHeader, Err: e}
+	}
+	return &TimeoutError{Phase: TimeoutRequest, Err: e}
+}
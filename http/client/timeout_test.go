@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeouts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New()
+	c.SetLogger("empty")
+	c.SetTimeout(50)
+
+	// the client timeout applies to non nil contexts
+	start := time.Now()
+	res := c.Get(context.Background(), srv.URL, nil, nil)
+	var te *TimeoutError
+	if !errors.Is(res.Error, ErrRequestTimeout) || !errors.As(res.Error, &te) || te.Phase != TimeoutRequest {
+		t.Fatalf("Expected request timeout, got %v", res.Error)
+	}
+	if time.Since(start) > 150*time.Millisecond {
+		t.Fatalf("Expected client timeout to apply, took %s", time.Since(start))
+	}
+
+	// a shorter caller deadline wins
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	res = c.Get(ctx, srv.URL, nil, nil)
+	if !errors.Is(res.Error, ErrRequestTimeout) || time.Since(start) > 45*time.Millisecond {
+		t.Fatalf("Expected caller deadline to apply, got %v after %s", res.Error, time.Since(start))
+	}
+
+	// per request override
+	res = c.Get(OverrideTimeout(context.Background(), time.Second), srv.URL, nil, nil)
+	if res.Error != nil {
+		t.Fatalf("Expected override to extend the timeout, got %v", res.Error)
+	}
+
+	c.SetTimeouts(Timeouts{Request: time.Second, ResponseHeader: 20 * time.Millisecond})
+	res = c.Get(context.Background(), srv.URL, nil, nil)
+	if !errors.Is(res.Error, ErrResponseHeaderTimeout) {
+		t.Fatalf("Expected response header timeout, got %v", res.Error)
+	}
+}
+
+func TestSetTimeoutsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"))
+	inflight := c
+	done := make(chan Res)
+	go func() {
+		done <- inflight.Get(context.Background(), srv.URL, nil, nil)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// runs against the request in flight without racing on its transport
+	c.SetTimeouts(Timeouts{Dial: time.Second, ResponseHeader: 500 * time.Millisecond})
+	close(release)
+	if res := <-done; res.Error != nil {
+		t.Fatalf("Expected the request in flight to complete, got %v", res.Error)
+	}
+	if c.Client == inflight.Client || c.dialer.Timeout != time.Second || inflight.dialer.Timeout != 10*time.Second {
+		t.Fatal("Expected a new transport for c only")
+	}
+	if res := c.Get(context.Background(), srv.URL, nil, nil); res.Error != nil {
+		t.Fatalf("Expected the new transport to work, got %v", res.Error)
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// accepts connections but never speaks tls
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, e := ln.Accept()
+			if e != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c, _ := New()
+	c.SetLogger("empty")
+	c.SetTimeouts(Timeouts{TLSHandshake: 20 * time.Millisecond})
+	res := c.Get(context.Background(), "https://"+ln.Addr().String(), nil, nil)
+	if !errors.Is(res.Error, ErrTLSHandshakeTimeout) {
+		t.Fatalf("Expected tls handshake timeout, got %v", res.Error)
+	}
+}
+
+type fakeTimeout struct{}
+
+func (fakeTimeout) Error() string   { return "i/o timeout" }
+func (fakeTimeout) Timeout() bool   { return true }
+func (fakeTimeout) Temporary() bool { return true }
+
+func TestTimeoutError(t *testing.T) {
+	ctx := context.Background()
+	dial := &dialError{&net.OpError{Op: "dial", Net: "tcp", Err: fakeTimeout{}}}
+	tests := []struct {
+		err    error
+		expect error
+	}{
+		{dial, ErrDialTimeout},
+		{fakeTimeout{}, ErrRequestTimeout},
+		{errors.New("connection refused"), nil},
+	}
+	for _, tt := range tests {
+		got := timeoutError(ctx, tt.err)
+		if tt.expect == nil {
+			if got != tt.err {
+				t.Errorf("%v: expected error unchanged, got %v", tt.err, got)
+			}
+			continue
+		}
+		var ne net.Error
+		if !errors.Is(got, tt.expect) || !errors.As(got, &ne) || !ne.Timeout() {
+			t.Errorf("%v: expected %v, got %v", tt.err, tt.expect, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultTraceHeaders - headers copied from the incoming request by TraceContext
+// when no header is given: w3c trace context, b3, request ids and baggage
+var DefaultTraceHeaders = []string{
+	"Traceparent",
+	"Tracestate",
+	"Baggage",
+	"X-Request-Id",
+	"X-Correlation-Id",
+	"X-B3-Traceid",
+	"X-B3-Spanid",
+	"X-B3-Parentspanid",
+	"X-B3-Sampled",
+	"B3",
+	"X-Cloud-Trace-Context",
+	"X-Amzn-Trace-Id",
+}
+
+type traceKey struct{}
+
+// TraceContext - returns a context carrying the trace headers of the incoming
+// request, outgoing calls made with it get them from the Trace middleware
+func TraceContext(ctx context.Context, incoming *http.Request, headers ...string) context.Context {
+	if len(headers) == 0 {
+		headers = DefaultTraceHeaders
+	}
+	hdr := traceHeaders(ctx).Clone()
+	for _, k := range headers {
+		if vs := incoming.Header.Values(k); len(vs) > 0 {
+			hdr[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+		}
+	}
+	return context.WithValue(ctx, traceKey{}, hdr)
+}
+
+// TraceHeader - returns a context carrying the header for outgoing calls,
+// e.g. a request id generated by the caller
+func TraceHeader(ctx context.Context, key string, value string) context.Context {
+	hdr := traceHeaders(ctx).Clone()
+	hdr.Set(key, value)
+	return context.WithValue(ctx, traceKey{}, hdr)
+}
+
+func traceHeaders(ctx context.Context) http.Header {
+	if hdr, ok := ctx.Value(traceKey{}).(http.Header); ok {
+		return hdr
+	}
+	return http.Header{}
+}
+
+// Trace - middleware setting the trace headers carried by the context of the
+// request, headers already set on the request are kept. extract adds headers
+// from other sources, e.g. an opentelemetry propagator, and may be nil
+func Trace(extract func(ctx context.Context, hdr http.Header)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			hdr := traceHeaders(req.Context()).Clone()
+			if extract != nil {
+				extract(req.Context(), hdr)
+			}
+			missing := false
+			for k := range hdr {
+				if req.Header.Get(k) == "" {
+					missing = true
+					break
+				}
+			}
+			if !missing {
+				return next.RoundTrip(req)
+			}
+			// the original request is reused by retries
+			clone := req.Clone(req.Context())
+			for k, vs := range hdr {
+				if clone.Header.Get(k) == "" {
+					clone.Header[k] = vs
+				}
+			}
+			return next.RoundTrip(clone)
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWebhookSchedule - delays between delivery attempts, a bit more than
+// a day in total as recommended by Standard Webhooks
+var DefaultWebhookSchedule = []time.Duration{
+	5 * time.Second,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	5 * time.Hour,
+	10 * time.Hour,
+	10 * time.Hour,
+}
+
+// ErrWebhookGone - the endpoint answered 410, deliveries to it should stop
+var ErrWebhookGone = errors.New("webhook endpoint gone")
+
+// WebhookOptions - options of NewWebhookDispatcher
+type WebhookOptions struct {
+	// Secret - signing secret, "whsec_" followed by the base64 key as issued by
+	// Standard Webhooks implementations, otherwise the raw key
+	Secret string
+	// Schedule - delays between attempts, defaults to DefaultWebhookSchedule
+	Schedule []time.Duration
+	// Jitter - fraction of each delay randomized, defaults to 0.1
+	Jitter float64
+	// OnAttempt - receives every attempt, e.g. to persist delivery logs
+	OnAttempt func(WebhookAttempt)
+	// Header - headers added to every delivery
+	Header map[string]string
+}
+
+// Webhook - message delivered to an endpoint
+type Webhook struct {
+	// ID - webhook-id header, the same for every attempt so receivers can
+	// deduplicate, generated when empty
+	ID      string
+	URL     string
+	Payload []byte
+}
+
+// WebhookAttempt - record of a delivery attempt
+type WebhookAttempt struct {
+	WebhookID string
+	URL       string
+	Attempt   int
+	Time      time.Time
+	Duration  time.Duration
+	// Status - response status, 0 when the request failed
+	Status int
+	// Error - why the attempt failed, empty on success
+	Error string
+	// Next - time of the next attempt, zero when there is none
+	Next time.Time
+}
+
+// WebhookDelivery - progress of a webhook dispatched in the background
+type WebhookDelivery struct {
+	Webhook  Webhook
+	mu       sync.Mutex
+	attempts []WebhookAttempt
+	err      error
+	done     chan struct{}
+}
+
+// Attempts - attempts made so far
+func (d *WebhookDelivery) Attempts() []WebhookAttempt {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]WebhookAttempt(nil), d.attempts...)
+}
+
+// Done - closed once the webhook is delivered or the attempts are exhausted
+func (d *WebhookDelivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait - waits for the delivery to finish and returns its error
+func (d *WebhookDelivery) Wait() error {
+	<-d.done
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// WebhookDispatcher - signs webhooks following Standard Webhooks and delivers
+// them with c, retrying failed attempts along the schedule
+type WebhookDispatcher struct {
+	client Client
+	opts   WebhookOptions
+	key    []byte
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWebhookDispatcher - creates a dispatcher signing with the secret of opts
+func NewWebhookDispatcher(c Client, opts WebhookOptions) (*WebhookDispatcher, error) {
+	key, e := webhookKey(opts.Secret)
+	if e != nil {
+		return nil, e
+	}
+	if opts.Schedule == nil {
+		opts.Schedule = DefaultWebhookSchedule
+	}
+	if opts.Jitter <= 0 {
+		opts.Jitter = 0.1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookDispatcher{client: c, opts: opts, key: key, ctx: ctx, cancel: cancel}, nil
+}
+
+// webhookKey decodes whsec_ prefixed secrets
+func webhookKey(secret string) ([]byte, error) {
+	if secret == "" {
+		return nil, errors.New("webhook secret missing")
+	}
+	if strings.HasPrefix(secret, "whsec_") {
+		return base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	}
+	return []byte(secret), nil
+}
+
+// Sign - returns the webhook-signature header of the payload, the signed
+// content is id.timestamp.payload
+func (d *WebhookDispatcher) Sign(id string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write([]byte(id + "." + strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(payload)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Send - makes a single signed attempt, non 2xx responses are errors
+func (d *WebhookDispatcher) Send(ctx context.Context, wh Webhook) WebhookAttempt {
+	if wh.ID == "" {
+		wh.ID = newWebhookID()
+	}
+	attempt, _ := d.send(ctx, wh, 1)
+	return attempt
+}
+
+// send returns the attempt and the response headers, if any
+func (d *WebhookDispatcher) send(ctx context.Context, wh Webhook, n int) (WebhookAttempt, http.Header) {
+	now := time.Now()
+	attempt := WebhookAttempt{WebhookID: wh.ID, URL: wh.URL, Attempt: n, Time: now}
+	res := d.client.Request(http.MethodPost, wh.URL).
+		Body("application/json", bytes.NewReader(wh.Payload)).
+		Headers(d.opts.Header).
+		SetHeader("webhook-id", wh.ID).
+		SetHeader("webhook-timestamp", strconv.FormatInt(now.Unix(), 10)).
+		SetHeader("webhook-signature", d.Sign(wh.ID, now, wh.Payload)).
+		Stream(ctx)
+	attempt.Duration = time.Since(now)
+	var se *StatusError
+	if res.Error != nil && !errors.As(res.Error, &se) {
+		attempt.Error = res.Error.Error()
+		return attempt, nil
+	}
+	// the body is of no interest, drain it so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(res.Response.Body, 64*1024))
+	res.Close()
+	attempt.Status = res.Response.StatusCode
+	if !success(attempt.Status) {
+		attempt.Error = "unexpected status " + strconv.Itoa(attempt.Status)
+	}
+	return attempt, res.Response.Header
+}
+
+// Deliver - sends the webhook until it succeeds, the schedule is exhausted,
+// the endpoint answers 410 or ctx is done, returns the attempts made
+func (d *WebhookDispatcher) Deliver(ctx context.Context, wh Webhook) ([]WebhookAttempt, error) {
+	delivery := d.delivery(wh)
+	d.deliver(ctx, delivery)
+	close(delivery.done)
+	return delivery.attempts, delivery.err
+}
+
+// Dispatch - delivers the webhook in the background, see Deliver
+func (d *WebhookDispatcher) Dispatch(wh Webhook) *WebhookDelivery {
+	delivery := d.delivery(wh)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer close(delivery.done)
+		d.deliver(d.ctx, delivery)
+	}()
+	return delivery
+}
+
+// Close - stops the background deliveries and waits for them to return
+func (d *WebhookDispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *WebhookDispatcher) delivery(wh Webhook) *WebhookDelivery {
+	if wh.ID == "" {
+		wh.ID = newWebhookID()
+	}
+	return &WebhookDelivery{Webhook: wh, done: make(chan struct{})}
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *WebhookDelivery) {
+	wh := delivery.Webhook
+	var err error
+	for n := 1; ; n++ {
+		attempt, header := d.send(ctx, wh, n)
+		switch {
+		case attempt.Error == "":
+			err = nil
+		case attempt.Status == http.StatusGone:
+			err = ErrWebhookGone
+		default:
+			err = errors.New("webhook delivery failed: " + attempt.Error)
+		}
+		var wait time.Duration
+		retry := err != nil && err != ErrWebhookGone && n <= len(d.opts.Schedule) && ctx.Err() == nil
+		if retry {
+			wait = d.jitter(d.opts.Schedule[n-1])
+			if after, ok := retryAfter(header.Get("Retry-After")); ok && after > wait {
+				wait = after
+			}
+			attempt.Next = time.Now().Add(wait)
+		}
+		delivery.mu.Lock()
+		delivery.attempts = append(delivery.attempts, attempt)
+		delivery.err = err
+		delivery.mu.Unlock()
+		if d.opts.OnAttempt != nil {
+			d.opts.OnAttempt(attempt)
+		}
+		if !retry {
+			if ctx.Err() != nil && err != nil {
+				delivery.mu.Lock()
+				delivery.err = ctx.Err()
+				delivery.mu.Unlock()
+			}
+			return
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			delivery.mu.Lock()
+			delivery.err = ctx.Err()
+			delivery.mu.Unlock()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// jitter randomizes the delay by the jitter fraction, either way
+func (d *WebhookDispatcher) jitter(delay time.Duration) time.Duration {
+	spread := int64(float64(delay) * d.opts.Jitter)
+	if spread <= 0 {
+		return delay
+	}
+	return delay - time.Duration(spread) + time.Duration(mrand.Int63n(2*spread+1))
+}
+
+// newWebhookID - random message id
+func newWebhookID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "msg_" + hex.EncodeToString(b)
+}
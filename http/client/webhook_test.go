@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	secret := "whsec_" + base64.StdEncoding.EncodeToString(key)
+	var calls int32
+	var mu sync.Mutex
+	var ids []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		id, ts := r.Header.Get("webhook-id"), r.Header.Get("webhook-timestamp")
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(id + "." + ts + "." + string(body)))
+		if r.Header.Get("webhook-signature") != "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		ids = append(ids, id)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/flaky":
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/down":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c, _ := New(WithLogger("empty"), WithStatusErrors(true))
+	if _, e := NewWebhookDispatcher(c, WebhookOptions{}); e == nil {
+		t.Fatal("Expected error without secret")
+	}
+	var recorded []WebhookAttempt
+	d, err := NewWebhookDispatcher(c, WebhookOptions{
+		Secret:    secret,
+		Schedule:  []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+		OnAttempt: func(a WebhookAttempt) { recorded = append(recorded, a) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"type":"order.paid","data":{"id":"o-1"}}`)
+	attempts, err := d.Deliver(context.Background(), Webhook{URL: srv.URL + "/flaky", Payload: payload})
+	if err != nil || len(attempts) != 3 || attempts[2].Status != 200 || attempts[0].Next.IsZero() || !attempts[2].Next.IsZero() {
+		t.Fatalf("Expected delivery on the third attempt, got %+v %v", attempts, err)
+	}
+	if len(recorded) != 3 || ids[0] != ids[2] || !strings.HasPrefix(ids[0], "msg_") {
+		t.Fatalf("Expected attempts to be recorded with a stable id, got %v %v", recorded, ids)
+	}
+
+	// 410 stops the deliveries
+	if attempts, err := d.Deliver(context.Background(), Webhook{URL: srv.URL + "/gone", Payload: payload}); !errors.Is(err, ErrWebhookGone) || len(attempts) != 1 {
+		t.Fatalf("Expected ErrWebhookGone after one attempt, got %v %d", err, len(attempts))
+	}
+	// the schedule is exhausted
+	if attempts, err := d.Deliver(context.Background(), Webhook{ID: "msg_1", URL: srv.URL + "/down", Payload: payload}); err == nil || len(attempts) != 4 || attempts[3].Status != 500 {
+		t.Fatalf("Expected 4 failed attempts, got %v %d", err, len(attempts))
+	}
+
+	// background deliveries stop on close
+	slow, _ := NewWebhookDispatcher(c, WebhookOptions{Secret: secret, Schedule: []time.Duration{time.Hour}})
+	delivery := slow.Dispatch(Webhook{URL: srv.URL + "/down", Payload: payload})
+	for len(delivery.Attempts()) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	slow.Close()
+	if err := delivery.Wait(); !errors.Is(err, context.Canceled) || len(delivery.Attempts()) != 1 {
+		t.Fatalf("Expected delivery to be cancelled, got %v %d", err, len(delivery.Attempts()))
+	}
+}
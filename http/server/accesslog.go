@@ -0,0 +1,281 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/urfave/negroni"
+)
+
+// access log formats
+const (
+	LogFormatJSON     = "json"
+	LogFormatCombined = "combined"
+)
+
+// access log fields selectable for the json format
+const (
+	LogFieldMethod    = "method"
+	LogFieldStatus    = "status"
+	LogFieldSrc       = "src"
+	LogFieldMs        = "ms"
+	LogFieldRoute     = "route"
+	LogFieldPath      = "path"
+	LogFieldQuery     = "query"
+	LogFieldBytesIn   = "bytes_in"
+	LogFieldBytesOut  = "bytes_out"
+	LogFieldUserAgent = "user_agent"
+	LogFieldReferer   = "referer"
+	LogFieldRequestID = "request_id"
+	LogFieldPrincipal = "principal"
+	LogFieldTenant    = "tenant"
+)
+
+// DefaultLogFields - fields logged when AccessLogOptions.Fields is empty
+var DefaultLogFields = []string{LogFieldMethod, LogFieldStatus, LogFieldSrc, LogFieldMs}
+
+// AccessLogOptions - options for the access log written by the catchall middleware
+type AccessLogOptions struct {
+	// Format - LogFormatJSON (default) or LogFormatCombined (Apache/NCSA)
+	Format string
+	// Fields - fields of the json format, defaults to DefaultLogFields
+	Fields []string
+	// SkipPaths - glob patterns as understood by path.Match, where * stays within
+	// a segment, e.g. /static/*, a trailing /** also matches every path below,
+	// e.g. /static/** for nested assets, replaces the list of SetLogSkipPath when
+	// not empty
+	SkipPaths []string
+	// SkipRegex - regular expressions matched against the url path
+	SkipRegex []string
+	// SampleRate - fraction of successful (< 400) requests logged, 0 logs all
+	SampleRate float64
+	// SlowThreshold - requests taking longer are always logged and flagged
+	SlowThreshold time.Duration
+	// RedactQuery - query parameters whose values are replaced in the log
+	RedactQuery []string
+}
+
+// accessLog is the compiled form of AccessLogOptions
+type accessLog struct {
+	opts      AccessLogOptions
+	skipRegex []*regexp.Regexp
+	bytesIn   bool
+}
+
+// SetAccessLog - changes the format and filtering of the access log
+func (rtr *Router) SetAccessLog(opts AccessLogOptions) error {
+	if opts.Format == "" {
+		opts.Format = LogFormatJSON
+	}
+	if opts.Format != LogFormatJSON && opts.Format != LogFormatCombined {
+		return fmt.Errorf("unknown access log format: %s", opts.Format)
+	}
+	if len(opts.Fields) == 0 {
+		opts.Fields = DefaultLogFields
+	}
+	al := &accessLog{opts: opts}
+	for _, expr := range opts.SkipRegex {
+		re, e := regexp.Compile(expr)
+		if e != nil {
+			return e
+		}
+		al.skipRegex = append(al.skipRegex, re)
+	}
+	for _, p := range opts.SkipPaths {
+		if _, e := path.Match(strings.TrimSuffix(p, "/**"), ""); e != nil {
+			return fmt.Errorf("invalid skip path %q: %w", p, e)
+		}
+	}
+	al.bytesIn = opts.Format == LogFormatCombined || contains(opts.Fields, LogFieldBytesIn)
+	rtr.accessLog = al
+	if len(opts.SkipPaths) > 0 {
+		rtr.logSkipPath = opts.SkipPaths
+	}
+	return nil
+}
+
+// skip decides whether a request stays out of the log, slow requests are always logged
+func (al *accessLog) skip(r *http.Request, skipPaths []string, status int, slow bool) bool {
+	if slow {
+		return false
+	}
+	for _, p := range skipPaths {
+		if matchSkipPath(p, r.URL.Path) {
+			return true
+		}
+	}
+	for _, re := range al.skipRegex {
+		if re.MatchString(r.URL.Path) {
+			return true
+		}
+	}
+	rate := al.opts.SampleRate
+	if status < http.StatusBadRequest && rate > 0 && rate < 1 {
+		return rand.Float64() >= rate
+	}
+	return false
+}
+
+// matchSkipPath matches a path.Match pattern, a trailing /** matches the
+// path itself and everything below it
+func matchSkipPath(pattern string, urlPath string) bool {
+	base := strings.TrimSuffix(pattern, "/**")
+	if base == pattern {
+		ok, _ := path.Match(pattern, urlPath)
+		return ok
+	}
+	// match the pattern against as many leading segments as it has
+	n := strings.Count(base, "/")
+	prefix := urlPath
+	if parts := strings.SplitN(urlPath, "/", n+2); len(parts) > n+1 {
+		prefix = strings.Join(parts[:n+1], "/")
+	}
+	ok, _ := path.Match(base, prefix)
+	return ok
+}
+
+func (al *accessLog) format(r *http.Request, w negroni.ResponseWriter, t1 time.Time, bytesIn int64, slow bool) string {
+	code := status(w, r)
+	if al.opts.Format == LogFormatCombined {
+		return al.combined(r, w, code, t1)
+	}
+	fields := map[string]string{}
+	for _, f := range al.opts.Fields {
+		switch f {
+		case LogFieldMethod:
+			fields[f] = r.Method
+		case LogFieldStatus:
+			fields[f] = strconv.Itoa(code)
+		case LogFieldSrc:
+			fields[f] = r.RemoteAddr
+		case LogFieldMs:
+			fields[f] = fmt.Sprintf("%f", float64(time.Since(t1).Microseconds())/1000)
+		case LogFieldRoute:
+			fields[f] = routePattern(r)
+		case LogFieldPath:
+			fields[f] = r.URL.Path
+		case LogFieldQuery:
+			fields[f] = al.query(r)
+		case LogFieldBytesIn:
+			fields[f] = strconv.FormatInt(bytesIn, 10)
+		case LogFieldBytesOut:
+			fields[f] = strconv.Itoa(w.Size())
+		case LogFieldUserAgent:
+			fields[f] = r.UserAgent()
+		case LogFieldReferer:
+			fields[f] = r.Referer()
+		case LogFieldRequestID:
+			fields[f] = requestID(r)
+		case LogFieldPrincipal:
+			fields[f] = GetPrincipal(r)
+		case LogFieldTenant:
+			fields[f] = GetTenantID(r)
+		}
+	}
+	if slow {
+		fields["slow"] = "true"
+	}
+	msg, _ := json.Marshal(fields)
+	return string(msg)
+}
+
+// combined renders the Apache/NCSA combined log format
+func (al *accessLog) combined(r *http.Request, w negroni.ResponseWriter, code int, t1 time.Time) string {
+	host, _, e := net.SplitHostPort(r.RemoteAddr)
+	if e != nil {
+		host = r.RemoteAddr
+	}
+	user := GetPrincipal(r)
+	if user == "" {
+		user = "-"
+	}
+	uri := r.URL.Path
+	if q := al.query(r); q != "" {
+		uri += "?" + q
+	}
+	size := "-"
+	if w.Size() > 0 {
+		size = strconv.Itoa(w.Size())
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s %q %q",
+		host, user, t1.Format("02/Jan/2006:15:04:05 -0700"), r.Method, uri, r.Proto,
+		code, size, r.Referer(), r.UserAgent())
+}
+
+func (al *accessLog) query(r *http.Request) string {
+	if r.URL.RawQuery == "" || len(al.opts.RedactQuery) == 0 {
+		return r.URL.RawQuery
+	}
+	values := r.URL.Query()
+	for _, k := range al.opts.RedactQuery {
+		if _, ok := values[k]; ok {
+			values.Set(k, "REDACTED")
+		}
+	}
+	return values.Encode()
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+func requestID(r *http.Request) string {
+	if id := middleware.GetReqID(r.Context()); id != "" {
+		return id
+	}
+	return r.Header.Get(middleware.RequestIDHeader)
+}
+
+// countingReader counts the request body bytes read by the handler
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, e := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, e
+}
+
+func (rtr *Router) countBody(r *http.Request) *countingReader {
+	if rtr.accessLog == nil || !rtr.accessLog.bytesIn || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	cr := &countingReader{ReadCloser: r.Body}
+	r.Body = cr
+	return cr
+}
+
+// logAccess writes the access log line of a finished request
+func (rtr *Router) logAccess(r *http.Request, w negroni.ResponseWriter, t1 time.Time, body *countingReader) {
+	al := rtr.accessLog
+	if al == nil {
+		al = defaultAccessLog
+	}
+	slow := al.opts.SlowThreshold > 0 && time.Since(t1) >= al.opts.SlowThreshold
+	if al.skip(r, rtr.logSkipPath, status(w, r), slow) {
+		return
+	}
+	var bytesIn int64
+	if body != nil {
+		bytesIn = body.n
+	}
+	rtr.log.Out(r.URL.Path, al.format(r, w, t1, bytesIn, slow))
+}
+
+var defaultAccessLog = &accessLog{opts: AccessLogOptions{Format: LogFormatJSON, Fields: DefaultLogFields}}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/urfave/negroni"
+)
+
+func TestSetAccessLog(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	if err := router.SetAccessLog(AccessLogOptions{Format: "xml"}); err == nil {
+		t.Error("Expected an error for unknown format")
+	}
+	if err := router.SetAccessLog(AccessLogOptions{SkipRegex: []string{"("}}); err == nil {
+		t.Error("Expected an error for invalid regex")
+	}
+	if err := router.SetAccessLog(AccessLogOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(router.logSkipPath) != 1 || router.logSkipPath[0] != "/" {
+		t.Error("Expected default skip path to be kept")
+	}
+}
+
+func TestAccessLogSkip(t *testing.T) {
+	router, _ := New(nil, nil)
+	router.SetAccessLog(AccessLogOptions{
+		SkipPaths:     []string{"/health", "/static/*", "/assets/**", "/users/*/avatar/**"},
+		SkipRegex:     []string{"^/metrics"},
+		SlowThreshold: time.Second,
+	})
+	al := router.accessLog
+	tests := []struct {
+		path   string
+		status int
+		slow   bool
+		skip   bool
+	}{
+		{"/health", 200, false, true},
+		{"/static/app.js", 200, false, true},
+		{"/static/js/app.js", 200, false, false},
+		{"/assets", 200, false, true},
+		{"/assets/js/vendor/app.js", 200, false, true},
+		{"/assetsx/app.js", 200, false, false},
+		{"/users/7/avatar/large.png", 200, false, true},
+		{"/users/7/profile", 200, false, false},
+		{"/metrics/prometheus", 200, false, true},
+		{"/health", 200, true, false},
+		{"/orders", 200, false, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if got := al.skip(r, router.logSkipPath, tt.status, tt.slow); got != tt.skip {
+			t.Errorf("%s slow=%v: expected skip %v, got %v", tt.path, tt.slow, tt.skip, got)
+		}
+	}
+
+	sampled := &accessLog{opts: AccessLogOptions{SampleRate: 0.000001}}
+	r := httptest.NewRequest("GET", "/orders", nil)
+	if !sampled.skip(r, nil, 200, false) {
+		t.Error("Expected successful request to be sampled out")
+	}
+	if sampled.skip(r, nil, 500, false) {
+		t.Error("Expected errors to always be logged")
+	}
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	router, _ := New(nil, nil)
+	router.SetLogger("empty")
+	router.SetAccessLog(AccessLogOptions{
+		Fields:      []string{LogFieldRoute, LogFieldQuery, LogFieldPrincipal, LogFieldRequestID, LogFieldBytesOut, LogFieldStatus},
+		RedactQuery: []string{"token"},
+	})
+	var line string
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, SetPrincipal(r, "alice"))
+		})
+	})
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w2 := negroni.NewResponseWriter(w)
+		// share the route context with the router so the matched pattern is visible
+		r = withRequestInfo(r)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, chi.NewRouteContext()))
+		router.Engine.ServeHTTP(w2, r)
+		line = router.accessLog.format(r, w2, time.Now(), 0, false)
+	})
+	req := httptest.NewRequest("GET", "/users/42?token=secret&page=1", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		t.Fatalf("Invalid json log line %q: %v", line, err)
+	}
+	expect := map[string]string{
+		"route":      "/users/{id}",
+		"query":      "page=1&token=REDACTED",
+		"principal":  "alice",
+		"request_id": "req-1",
+		"bytes_out":  "5",
+		"status":     "200",
+	}
+	for k, v := range expect {
+		if fields[k] != v {
+			t.Errorf("Field %s: expected %q, got %q", k, v, fields[k])
+		}
+	}
+
+	combined := &accessLog{opts: AccessLogOptions{Format: LogFormatCombined}}
+	req = httptest.NewRequest("POST", "/orders?x=1", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	w := negroni.NewResponseWriter(httptest.NewRecorder())
+	w.WriteHeader(http.StatusCreated)
+	line = combined.format(req, w, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), 0, false)
+	if !strings.HasPrefix(line, `192.0.2.1 - - [02/Jan/2024:03:04:05 +0000] "POST /orders?x=1 HTTP/1.1" 201 - "" "test-agent"`) {
+		t.Errorf("Unexpected combined log line %q", line)
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// CompressOptions - options for the response compression middleware
+type CompressOptions struct {
+	// Level - compression level, 0 uses the default of each encoder
+	Level int
+	// MinSize - responses smaller than this (in bytes) are sent uncompressed, defaults to 1024
+	MinSize int
+	// ContentTypes - allowlist of compressible types, "text/*" style wildcards are supported
+	ContentTypes []string
+	// Encodings - supported encodings in order of server preference, defaults to br, gzip, deflate
+	Encodings []string
+}
+
+// DefaultCompressTypes - content types compressed when CompressOptions.ContentTypes is empty
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/problem+json",
+	"image/svg+xml",
+}
+
+// Compress - middleware negotiating br, gzip or deflate response compression with
+// the client, should be placed before ETag so tags are computed on the raw body
+func Compress(opts CompressOptions) Middleware {
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1024
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultCompressTypes
+	}
+	if len(opts.Encodings) == 0 {
+		opts.Encodings = []string{"br", "gzip", "deflate"}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				opts:           &opts,
+				encoding:       encoding,
+				status:         http.StatusOK,
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter buffers the response until MinSize is reached, then decides
+// whether to stream it through an encoder or send it as is
+type compressWriter struct {
+	http.ResponseWriter
+	opts        *CompressOptions
+	encoding    string
+	status      int
+	wroteHeader bool
+	decided     bool
+	hijacked    bool
+	buf         []byte
+	enc         io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = code
+	// responses without a body are committed right away
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.opts.MinSize {
+		if e := cw.decide(true); e != nil {
+			return 0, e
+		}
+	}
+	return len(p), nil
+}
+
+// Flush - commits the response so streaming handlers keep working
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack - allows connection upgrades to pass through untouched
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("compress: underlying writer does not support hijack")
+	}
+	cw.hijacked = true
+	return h.Hijack()
+}
+
+// Unwrap - exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) decide(allowed bool) error {
+	cw.decided = true
+	hdr := cw.Header()
+	if allowed && hdr.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		hdr.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	compressible := matchContentType(hdr.Get("Content-Type"), cw.opts.ContentTypes)
+	if compressible {
+		hdr.Add("Vary", "Accept-Encoding")
+	}
+	if allowed && compressible && cw.canEncode() {
+		hdr.Set("Content-Encoding", cw.encoding)
+		hdr.Del("Content-Length")
+		// the encoded representation is no longer byte identical
+		if etag := hdr.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			hdr.Set("ETag", "W/"+etag)
+		}
+		cw.enc = newEncoder(cw.encoding, cw.opts.Level, cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var e error
+	if cw.enc != nil {
+		_, e = cw.enc.Write(cw.buf)
+	} else {
+		_, e = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return e
+}
+
+func (cw *compressWriter) canEncode() bool {
+	hdr := cw.Header()
+	if hdr.Get("Content-Encoding") != "" || hdr.Get("Content-Range") != "" {
+		return false
+	}
+	return cw.status != http.StatusPartialContent
+}
+
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		// nothing was written or the body stayed under MinSize
+		if !cw.wroteHeader && len(cw.buf) == 0 {
+			return
+		}
+		cw.decide(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+	}
+}
+
+func newEncoder(encoding string, level int, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case "br":
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level)
+	case "deflate":
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+		enc, e := flate.NewWriter(w, level)
+		if e != nil {
+			enc, _ = flate.NewWriter(w, flate.DefaultCompression)
+		}
+		return enc
+	default:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		enc, e := gzip.NewWriterLevel(w, level)
+		if e != nil {
+			enc = gzip.NewWriter(w)
+		}
+		return enc
+	}
+}
+
+// negotiateEncoding picks the first supported encoding accepted by the client,
+// honouring q=0 exclusions and the * wildcard
+func negotiateEncoding(accept string, supported []string) string {
+	if accept == "" {
+		return ""
+	}
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, e := strconv.ParseFloat(f[2:], 64); e == nil {
+					q = v
+				}
+			}
+		}
+		accepted[name] = q
+	}
+	for _, enc := range supported {
+		q, ok := accepted[enc]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > 0 {
+			return enc
+		}
+	}
+	return ""
+}
+
+// matchContentType checks a content type header against an allowlist
+// supporting "type/*" wildcards, parameters such as charset are ignored
+func matchContentType(contentType string, list []string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if ct == "" {
+		return false
+	}
+	for _, allowed := range list {
+		allowed = strings.ToLower(allowed)
+		if allowed == ct || allowed == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(ct, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"br", "gzip", "deflate"}
+	tests := []struct {
+		accept string
+		expect string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0, gzip;q=0.5", "gzip"},
+		{"*", "br"},
+		{"*, br;q=0", "gzip"},
+		{"identity", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.accept, supported); got != tt.expect {
+			t.Errorf("Accept-Encoding %q: expected %q, got %q", tt.accept, tt.expect, got)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"status":"success"}`, 100)
+	handler := func(ct string, body string) http.Handler {
+		return Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ct)
+			w.Write([]byte(body))
+		}))
+	}
+
+	tests := []struct {
+		name     string
+		accept   string
+		ct       string
+		body     string
+		encoding string
+	}{
+		{"gzip json", "gzip", "application/json", large, "gzip"},
+		{"brotli json", "br, gzip", "application/json", large, "br"},
+		{"below min size", "gzip", "application/json", `{"status":"success"}`, ""},
+		{"not in allowlist", "gzip", "image/png", large, ""},
+		{"not accepted", "", "application/json", large, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			resp := httptest.NewRecorder()
+			handler(tt.ct, tt.body).ServeHTTP(resp, req)
+			if got := resp.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Expected encoding %q, got %q", tt.encoding, got)
+			}
+			var reader io.Reader = resp.Body
+			switch tt.encoding {
+			case "gzip":
+				gz, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reader = gz
+			case "br":
+				reader = brotli.NewReader(resp.Body)
+			}
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(body, []byte(tt.body)) {
+				t.Errorf("Body mismatch after decoding")
+			}
+		})
+	}
+}
+
+func TestCompressWeakensETag(t *testing.T) {
+	h := Compress(CompressOptions{MinSize: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("hello world"))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	if got := resp.Header().Get("ETag"); got != `W/"abc"` {
+		t.Errorf("Expected weak etag, got %q", got)
+	}
+	if got := resp.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary header, got %q", got)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type principalKey struct{}
+
+type requestInfoKey struct{}
+
+// requestInfo is placed in the context by the catchall middleware so values set
+// further down the chain are visible to it once the handler returns
+type requestInfo struct {
+	mu        sync.Mutex
+	principal string
+	tenant    string
+}
+
+// SetPrincipal - returns a shallow copy of the request carrying the authenticated
+// principal, meant to be called by auth middlewares
+func SetPrincipal(r *http.Request, principal string) *http.Request {
+	if info := getRequestInfo(r); info != nil {
+		info.mu.Lock()
+		info.principal = principal
+		info.mu.Unlock()
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// GetPrincipal - returns the principal stored with SetPrincipal, empty if none
+func GetPrincipal(r *http.Request) string {
+	if principal, ok := r.Context().Value(principalKey{}).(string); ok {
+		return principal
+	}
+	if info := getRequestInfo(r); info != nil {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		return info.principal
+	}
+	return ""
+}
+
+func withRequestInfo(r *http.Request) *http.Request {
+	if getRequestInfo(r) != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, &requestInfo{}))
+}
+
+func getRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
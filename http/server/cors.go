@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CorsOptions takes in the options for CORS
+type CorsOptions struct {
+	// Origins - allowed origins, "*" allows all without credentials and wildcard
+	// subdomains such as https://*.example.com are supported, defaults to
+	// http(s)://localhost
+	Origins []string
+	// Headers - allowed request headers on top of Accept, Authorization,
+	// Content-Type and X-CSRF-Token, "*" allows all
+	Headers []string
+	// AllowedOriginFunc - custom origin check, Origins is ignored when set
+	AllowedOriginFunc func(r *http.Request, origin string) bool
+	// Methods - allowed methods, defaults to GET, POST, PUT, DELETE, OPTIONS and PATCH
+	Methods []string
+	// ExposedHeaders - response headers readable by the browser, defaults to Link
+	ExposedHeaders []string
+	// DisableCredentials - stop allowing cookies and authorization on cross origin requests
+	DisableCredentials bool
+	// MaxAge - how long browsers may cache a preflight, defaults to 12h, negative disables caching
+	MaxAge time.Duration
+	// AllowPrivateNetwork - allow public websites to reach the server on a private
+	// network, answers the Access-Control-Request-Private-Network preflight
+	AllowPrivateNetwork bool
+	// Tenants - the origins of the tenant of the request, resolved as by the
+	// Tenant middleware with these options, are allowed on top of Origins,
+	// preflights included, the store is queried for every cross origin request
+	Tenants *TenantOptions
+}
+
+var (
+	defaultCorsOrigins = []string{"http://localhost", "https://localhost"}
+	defaultCorsHeaders = []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"}
+	defaultCorsMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"}
+)
+
+// corsHandler dispatches requests to the policy of the longest matching group
+// prefix, preflights are answered before routing so overrides can't be regular
+// group middlewares
+type corsHandler struct {
+	root   *corsPolicy
+	mu     sync.RWMutex
+	groups []corsGroup
+}
+
+type corsGroup struct {
+	prefix string
+	policy *corsPolicy
+}
+
+// corsPolicy is the compiled form of CorsOptions, origins are swapped atomically
+// on reload, a policy without origins of its own follows its parent
+type corsPolicy struct {
+	opts       CorsOptions
+	methods    []string
+	headers    []string
+	headersAll bool
+	maxAge     string
+	origins    atomic.Value
+	parent     *corsPolicy
+}
+
+type corsOrigins struct {
+	all  bool
+	list []string
+}
+
+func newCorsHandler(opts CorsOptions) *corsHandler {
+	return &corsHandler{root: newCorsPolicy(opts, nil)}
+}
+
+// newCorsPolicy compiles options, empty lists and durations are taken from parent
+// when given, otherwise from the defaults
+func newCorsPolicy(opts CorsOptions, parent *corsPolicy) *corsPolicy {
+	p := &corsPolicy{parent: parent}
+	if parent != nil {
+		if len(opts.Methods) == 0 {
+			opts.Methods = parent.opts.Methods
+		}
+		if len(opts.Headers) == 0 {
+			opts.Headers = parent.opts.Headers
+		}
+		if len(opts.ExposedHeaders) == 0 {
+			opts.ExposedHeaders = parent.opts.ExposedHeaders
+		}
+		if opts.MaxAge == 0 {
+			opts.MaxAge = parent.opts.MaxAge
+		}
+		if opts.Tenants == nil {
+			opts.Tenants = parent.opts.Tenants
+		}
+	} else {
+		if len(opts.Methods) == 0 {
+			opts.Methods = defaultCorsMethods
+		}
+		if len(opts.Headers) == 0 {
+			opts.Headers = defaultCorsHeaders
+		} else {
+			opts.Headers = append(append([]string{}, opts.Headers...), defaultCorsHeaders...)
+		}
+		if len(opts.ExposedHeaders) == 0 {
+			opts.ExposedHeaders = []string{"Link"}
+		}
+		if opts.MaxAge == 0 {
+			opts.MaxAge = 12 * time.Hour
+		}
+	}
+	p.opts = opts
+	for _, m := range opts.Methods {
+		p.methods = append(p.methods, strings.ToUpper(m))
+	}
+	for _, h := range opts.Headers {
+		if h == "*" {
+			p.headersAll = true
+		}
+		p.headers = append(p.headers, http.CanonicalHeaderKey(h))
+	}
+	if opts.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+	if parent == nil || len(opts.Origins) > 0 {
+		p.setOrigins(opts.Origins)
+	}
+	return p
+}
+
+// setOrigins replaces the allowed origins, the root policy falls back to localhost
+func (p *corsPolicy) setOrigins(origins []string) {
+	if len(origins) == 0 && p.parent == nil {
+		origins = defaultCorsOrigins
+	}
+	o := &corsOrigins{}
+	for _, origin := range origins {
+		if origin == "*" {
+			o.all = true
+		}
+		o.list = append(o.list, strings.ToLower(origin))
+	}
+	p.origins.Store(o)
+}
+
+func (p *corsPolicy) loadOrigins() *corsOrigins {
+	if o, ok := p.origins.Load().(*corsOrigins); ok {
+		return o
+	}
+	return p.parent.loadOrigins()
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value, empty if not allowed
+func (p *corsPolicy) allowOrigin(r *http.Request, origin string) string {
+	if p.opts.AllowedOriginFunc != nil {
+		if p.opts.AllowedOriginFunc(r, origin) {
+			return origin
+		}
+		return ""
+	}
+	o := p.loadOrigins()
+	// a literal "*" is sent, browsers refuse it on credentialed requests so
+	// every site may read public responses but none with the user's cookies
+	if o.all {
+		return "*"
+	}
+	if originAllowed(origin, o.list) {
+		return origin
+	}
+	if p.opts.Tenants != nil && p.opts.Tenants.originAllowed(r, origin) {
+		return origin
+	}
+	return ""
+}
+
+func (p *corsPolicy) methodAllowed(method string) bool {
+	method = strings.ToUpper(method)
+	return method == http.MethodOptions || contains(p.methods, method)
+}
+
+func (p *corsPolicy) headersAllowed(requested []string) bool {
+	if p.headersAll {
+		return true
+	}
+	for _, h := range requested {
+		if !contains(p.headers, http.CanonicalHeaderKey(h)) {
+			return false
+		}
+	}
+	return true
+}
+
+// handler applies the CORS specification, preflights stop the chain as
+// authentication middlewares usually reject OPTIONS requests
+func (c *corsHandler) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := c.policy(r.URL.Path)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			p.preflight(w, r)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		p.actual(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request) {
+	hdr := w.Header()
+	hdr.Add("Vary", "Origin")
+	hdr.Add("Vary", "Access-Control-Request-Method")
+	hdr.Add("Vary", "Access-Control-Request-Headers")
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	allow := p.allowOrigin(r, origin)
+	method := r.Header.Get("Access-Control-Request-Method")
+	var reqHeaders []string
+	for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			reqHeaders = append(reqHeaders, h)
+		}
+	}
+	if allow == "" || !p.methodAllowed(method) || !p.headersAllowed(reqHeaders) {
+		return
+	}
+	hdr.Set("Access-Control-Allow-Origin", allow)
+	hdr.Set("Access-Control-Allow-Methods", strings.ToUpper(method))
+	if len(reqHeaders) > 0 {
+		hdr.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+	if !p.opts.DisableCredentials && allow != "*" {
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if p.maxAge != "" {
+		hdr.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	if p.opts.AllowPrivateNetwork && r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+		hdr.Set("Access-Control-Allow-Private-Network", "true")
+	}
+}
+
+func (p *corsPolicy) actual(w http.ResponseWriter, r *http.Request) {
+	hdr := w.Header()
+	hdr.Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if origin == "" || !p.methodAllowed(r.Method) {
+		return
+	}
+	allow := p.allowOrigin(r, origin)
+	if allow == "" {
+		return
+	}
+	hdr.Set("Access-Control-Allow-Origin", allow)
+	if len(p.opts.ExposedHeaders) > 0 {
+		hdr.Set("Access-Control-Expose-Headers", strings.Join(p.opts.ExposedHeaders, ", "))
+	}
+	if !p.opts.DisableCredentials && allow != "*" {
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// policy returns the policy of the longest group prefix matching the path
+func (c *corsHandler) policy(path string) *corsPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, g := range c.groups {
+		if path == g.prefix || strings.HasPrefix(path, g.prefix+"/") {
+			return g.policy
+		}
+	}
+	return c.root
+}
+
+// override registers the policy of a group prefix, replacing a previous one
+func (c *corsHandler) override(prefix string, opts CorsOptions) {
+	p := newCorsPolicy(opts, c.root)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, g := range c.groups {
+		if g.prefix == prefix {
+			c.groups[i].policy = p
+			return
+		}
+	}
+	c.groups = append(c.groups, corsGroup{prefix: prefix, policy: p})
+	sort.SliceStable(c.groups, func(i, j int) bool {
+		return len(c.groups[i].prefix) > len(c.groups[j].prefix)
+	})
+}
+
+// SetCors - overrides the router CORS settings for every route under the group
+// prefix, empty lists and durations are inherited from the router, groups
+// without origins follow the router origins including reloads
+func (g *Group) SetCors(opts CorsOptions) {
+	if g.cors == nil {
+		return
+	}
+	g.cors.override(g.path, opts)
+}
+
+// SetCorsOrigins - replaces the router wide allowed origins without restarting,
+// an empty list falls back to http(s)://localhost
+func (rtr Router) SetCorsOrigins(origins []string) {
+	rtr.cors.root.setOrigins(origins)
+}
+
+// CorsOrigins - returns the router wide allowed origins currently in use
+func (rtr Router) CorsOrigins() []string {
+	return append([]string{}, rtr.cors.root.loadOrigins().list...)
+}
+
+// WatchCorsOrigins - loads the router wide allowed origins from source now and
+// then every interval until ctx is done, an error is returned if the first load
+// fails, later failures are logged and keep the previous origins
+func (rtr Router) WatchCorsOrigins(ctx context.Context, interval time.Duration, source func(ctx context.Context) ([]string, error)) error {
+	origins, e := source(ctx)
+	if e != nil {
+		return e
+	}
+	rtr.SetCorsOrigins(origins)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				origins, e := source(ctx)
+				if e != nil {
+					rtr.log.Error("CORS_RELOAD", e)
+					continue
+				}
+				rtr.SetCorsOrigins(origins)
+			}
+		}
+	}()
+	return nil
+}
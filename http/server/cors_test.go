@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCors(t *testing.T) {
+	router, err := NewWithCorsOptions(&CorsOptions{
+		Origins:             []string{"https://app.example.com", "https://*.example.org"},
+		Headers:             []string{"X-Tenant-ID"},
+		ExposedHeaders:      []string{"X-Total-Count"},
+		MaxAge:              time.Minute,
+		AllowPrivateNetwork: true,
+	})
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	public := router.Group("/public")
+	public.SetCors(CorsOptions{Origins: []string{"*"}, DisableCredentials: true, Methods: []string{"GET"}})
+	open := router.Group("/open")
+	open.SetCors(CorsOptions{Origins: []string{"*"}})
+	partner := router.Group("/partner")
+	partner.SetCors(CorsOptions{MaxAge: -1})
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.Get("/orders", ok)
+	router.Post("/orders", ok)
+	public.Get("/feed", ok)
+	public.Post("/feed", ok)
+	partner.Get("/orders", ok)
+	open.Get("/feed", ok)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+		expect map[string]string
+	}{
+		{"exact origin", "GET", "/orders", map[string]string{"Origin": "https://app.example.com"}, map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Expose-Headers":    "X-Total-Count",
+		}},
+		{"wildcard subdomain", "GET", "/orders", map[string]string{"Origin": "https://eu.example.org"}, map[string]string{
+			"Access-Control-Allow-Origin": "https://eu.example.org",
+		}},
+		{"wildcard needs a subdomain", "GET", "/orders", map[string]string{"Origin": "https://example.org"}, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"unknown origin", "GET", "/orders", map[string]string{"Origin": "https://evil.com"}, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"preflight", "OPTIONS", "/orders", map[string]string{
+			"Origin":                                 "https://app.example.com",
+			"Access-Control-Request-Method":          "POST",
+			"Access-Control-Request-Headers":         "content-type, x-tenant-id",
+			"Access-Control-Request-Private-Network": "true",
+		}, map[string]string{
+			"Access-Control-Allow-Origin":          "https://app.example.com",
+			"Access-Control-Allow-Methods":         "POST",
+			"Access-Control-Allow-Headers":         "content-type, x-tenant-id",
+			"Access-Control-Max-Age":               "60",
+			"Access-Control-Allow-Private-Network": "true",
+		}},
+		{"preflight unknown header", "OPTIONS", "/orders", map[string]string{
+			"Origin":                         "https://app.example.com",
+			"Access-Control-Request-Method":  "POST",
+			"Access-Control-Request-Headers": "x-other",
+		}, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"group any origin", "GET", "/public/feed", map[string]string{"Origin": "https://evil.com"}, map[string]string{
+			"Access-Control-Allow-Origin":      "*",
+			"Access-Control-Allow-Credentials": "",
+		}},
+		{"any origin never with credentials", "GET", "/open/feed", map[string]string{"Origin": "https://evil.example"}, map[string]string{
+			"Access-Control-Allow-Origin":      "*",
+			"Access-Control-Allow-Credentials": "",
+		}},
+		{"any origin preflight never with credentials", "OPTIONS", "/open/feed", map[string]string{
+			"Origin":                        "https://evil.example",
+			"Access-Control-Request-Method": "GET",
+		}, map[string]string{
+			"Access-Control-Allow-Origin":      "*",
+			"Access-Control-Allow-Credentials": "",
+		}},
+		{"group method", "OPTIONS", "/public/feed", map[string]string{
+			"Origin":                        "https://evil.com",
+			"Access-Control-Request-Method": "POST",
+		}, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"group inherits origins", "OPTIONS", "/partner/orders", map[string]string{
+			"Origin":                        "https://app.example.com",
+			"Access-Control-Request-Method": "GET",
+		}, map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Max-Age":           "",
+		}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		resp := httptest.NewRecorder()
+		router.Engine.ServeHTTP(resp, req)
+		for k, v := range tt.expect {
+			if got := resp.Header().Get(k); got != v {
+				t.Errorf("%s: expected %s %q, got %q", tt.name, k, v, got)
+			}
+		}
+	}
+}
+
+func TestWatchCorsOrigins(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	router.Get("/orders", func(w http.ResponseWriter, r *http.Request) {})
+	var calls int32
+	source := func(ctx context.Context) ([]string, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return []string{"https://new.example.com"}, nil
+		}
+		return []string{"https://old.example.com"}, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if e := router.WatchCorsOrigins(ctx, 10*time.Millisecond, source); e != nil {
+		t.Fatalf("Unexpected error %v", e)
+	}
+	if got := router.CorsOrigins(); len(got) != 1 || got[0] != "https://old.example.com" {
+		t.Fatalf("Expected initial origins, got %v", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for router.CorsOrigins()[0] != "https://new.example.com" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected origins to be reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req.Header.Set("Origin", "https://new.example.com")
+	resp := httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, req)
+	if resp.Header().Get("Access-Control-Allow-Origin") != "https://new.example.com" {
+		t.Fatal("Expected reloaded origin to be allowed")
+	}
+
+	failing := func(ctx context.Context) ([]string, error) {
+		return nil, errors.New("config unavailable")
+	}
+	if e := router.WatchCorsOrigins(ctx, time.Minute, failing); e == nil {
+		t.Fatal("Expected error on failed first load")
+	}
+}
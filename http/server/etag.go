@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ETagOptions - options for the etag middleware
+type ETagOptions struct {
+	// Weak - generate weak (W/"...") validators instead of strong ones
+	Weak bool
+	// ContentTypes - responses eligible for etag generation, defaults to application/json
+	ContentTypes []string
+}
+
+// ETag - middleware generating etags for successful GET/HEAD json responses and
+// answering If-None-Match and If-Modified-Since with 304 Not Modified
+func ETag(opts ETagOptions) Middleware {
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = []string{"application/json", "application/problem+json"}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ew := &etagWriter{
+				ResponseWriter: w,
+				opts:           &opts,
+				status:         http.StatusOK,
+			}
+			next.ServeHTTP(ew, r)
+			ew.finish(r)
+		})
+	}
+}
+
+// etagWriter buffers eligible responses so the tag can be computed from the
+// full body, anything else is passed through as soon as the header is written
+type etagWriter struct {
+	http.ResponseWriter
+	opts        *ETagOptions
+	status      int
+	wroteHeader bool
+	buffering   bool
+	passthrough bool
+	buf         []byte
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	ew.status = code
+	hdr := ew.Header()
+	if code == http.StatusOK && hdr.Get("ETag") == "" && matchContentType(hdr.Get("Content-Type"), ew.opts.ContentTypes) {
+		ew.buffering = true
+		return
+	}
+	ew.passthrough = true
+	ew.ResponseWriter.WriteHeader(code)
+}
+
+func (ew *etagWriter) Write(p []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.buffering {
+		ew.buf = append(ew.buf, p...)
+		return len(p), nil
+	}
+	return ew.ResponseWriter.Write(p)
+}
+
+// Flush - streaming responses can't be tagged, flush gives up on buffering
+func (ew *etagWriter) Flush() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.buffering {
+		ew.buffering = false
+		ew.passthrough = true
+		ew.ResponseWriter.WriteHeader(ew.status)
+		ew.ResponseWriter.Write(ew.buf)
+		ew.buf = nil
+	}
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack - allows connection upgrades to pass through untouched
+func (ew *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := ew.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("etag: underlying writer does not support hijack")
+	}
+	ew.passthrough = true
+	return h.Hijack()
+}
+
+// Unwrap - exposes the underlying writer to http.ResponseController
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+func (ew *etagWriter) finish(r *http.Request) {
+	if ew.passthrough || !ew.buffering {
+		return
+	}
+	hdr := ew.Header()
+	sum := sha256.Sum256(ew.buf)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if ew.opts.Weak {
+		etag = "W/" + etag
+	}
+	hdr.Set("ETag", etag)
+	if notModified(r, hdr) {
+		hdr.Del("Content-Type")
+		hdr.Del("Content-Length")
+		ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	hdr.Set("Content-Length", strconv.Itoa(len(ew.buf)))
+	ew.ResponseWriter.WriteHeader(ew.status)
+	if r.Method != http.MethodHead {
+		ew.ResponseWriter.Write(ew.buf)
+	}
+}
+
+// notModified evaluates the conditional request headers, If-None-Match takes
+// precedence over If-Modified-Since as per RFC 9110
+func notModified(r *http.Request, hdr http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, hdr.Get("ETag"))
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	lm := hdr.Get("Last-Modified")
+	if ims == "" || lm == "" {
+		return false
+	}
+	since, e := http.ParseTime(ims)
+	if e != nil {
+		return false
+	}
+	modified, e := http.ParseTime(lm)
+	if e != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// etagMatch does a weak comparison of a If-None-Match list against an etag
+func etagMatch(list string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	router.Use(ETag(ETagOptions{}))
+	router.Get("/json", func(w http.ResponseWriter, r *http.Request) {
+		JSON(w, r, map[string]string{"status": "success"})
+	})
+	router.Get("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest("GET", "/json", nil)
+	resp := httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, req)
+	etag := resp.Header().Get("ETag")
+	if resp.Code != http.StatusOK || etag == "" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("Expected 200 with strong etag, got %d %q", resp.Code, etag)
+	}
+
+	req = httptest.NewRequest("GET", "/json", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	resp = httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotModified || resp.Body.Len() != 0 {
+		t.Fatalf("Expected 304 without body, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/json", nil)
+	req.Header.Set("If-None-Match", `"other"`)
+	resp = httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for mismatched etag, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/text", nil)
+	resp = httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, req)
+	if resp.Header().Get("ETag") != "" || resp.Body.String() != "hello" {
+		t.Fatalf("Expected non json response to pass through untouched")
+	}
+}
+
+func TestNotModifiedSince(t *testing.T) {
+	lm := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hdr := http.Header{}
+	hdr.Set("Last-Modified", lm.Format(http.TimeFormat))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-Modified-Since", lm.Add(time.Hour).Format(http.TimeFormat))
+	if !notModified(req, hdr) {
+		t.Error("Expected not modified when resource is older")
+	}
+	req.Header.Set("If-Modified-Since", lm.Add(-time.Hour).Format(http.TimeFormat))
+	if notModified(req, hdr) {
+		t.Error("Expected modified when resource is newer")
+	}
+}
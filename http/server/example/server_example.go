@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
+	"os"
 
 	"github.com/kelchy/go-lib/http/server"
 )
@@ -18,10 +19,8 @@ func main() {
 		})
 	})
 
-	// use "esc" to create a "codified" version of static files and declare like this
-	// https://github.com/mjibson/esc
-	// for example ~/go/bin/esc -o testdir/test.go -pkg static -ignore=".*.go" testdir
-	//rtr.StaticFs("/test/", static.FS(false))
+	// serve static files from an embed.FS or any fs.FS, unknown routes fall back to index.html
+	rtr.ServeFS("/app", os.DirFS("./public"), server.StaticOptions{SPA: true})
 
 	// api definition
 	rtr.Get("/welcome", func(w http.ResponseWriter, r *http.Request) {
@@ -1,11 +1,12 @@
-//v0.1.3
+//v0.1.20
 module github.com/kelchy/go-lib/http/server
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/go-chi/chi v1.5.4
-	github.com/go-chi/cors v1.2.1
 	github.com/go-chi/render v1.0.2
-	github.com/kelchy/go-lib/log v0.0.10
+	github.com/gorilla/websocket v1.5.3
+	github.com/kelchy/go-lib/log v0.1.3
 	github.com/urfave/negroni v1.0.0
 	golang.org/x/net v0.0.0-20220826154423-83b083e8dc8b
 )
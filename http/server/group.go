@@ -0,0 +1,186 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// Middleware - standard net/http middleware signature accepted by the router
+type Middleware = func(http.Handler) http.Handler
+
+// Group - router-like instance scoped to a url prefix with its own middleware stack
+type Group struct {
+	Engine chi.Router
+	prefix string
+	// path is the absolute url prefix, it differs from prefix for mounted groups
+	path string
+	cors *corsHandler
+}
+
+// Route - description of a registered route, used for debugging
+type Route struct {
+	Method      string `json:"method"`
+	Pattern     string `json:"pattern"`
+	Middlewares int    `json:"middlewares"`
+}
+
+// Use - appends middlewares to the router, must be called before any route is defined
+func (rtr Router) Use(middlewares ...Middleware) {
+	rtr.Engine.Use(middlewares...)
+}
+
+// Handle - attach a plain http.Handler to all methods of a route
+func (rtr Router) Handle(route string, handler http.Handler) {
+	rtr.Engine.Handle(route, handler)
+}
+
+// Group - creates an inline group of routes under prefix sharing the router tree,
+// the middlewares only apply to routes defined through the returned group
+func (rtr Router) Group(prefix string, middlewares ...Middleware) *Group {
+	prefix = cleanPrefix(prefix)
+	return &Group{
+		Engine: rtr.Engine.With(middlewares...),
+		prefix: prefix,
+		path:   prefix,
+		cors:   rtr.cors,
+	}
+}
+
+// Mount - creates a standalone sub-router mounted under prefix, the middlewares
+// only run for requests matching the prefix
+func (rtr Router) Mount(prefix string, middlewares ...Middleware) *Group {
+	g := mount(rtr.Engine, cleanPrefix(prefix), middlewares)
+	g.cors = rtr.cors
+	return g
+}
+
+// Version - convenience to group versioned api routes, e.g. Version("v1") serves /v1/...
+func (rtr Router) Version(version string, middlewares ...Middleware) *Group {
+	return rtr.Group(version, middlewares...)
+}
+
+// Routes - returns the list of all registered routes sorted by pattern then method
+func (rtr Router) Routes() []Route {
+	return walkRoutes(rtr.Engine)
+}
+
+// Prefix - returns the url prefix of the group
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Use - appends middlewares to the group, must be called before any route is defined
+func (g *Group) Use(middlewares ...Middleware) {
+	g.Engine.Use(middlewares...)
+}
+
+// Group - creates a nested inline group under the current prefix
+func (g *Group) Group(prefix string, middlewares ...Middleware) *Group {
+	prefix = cleanPrefix(prefix)
+	return &Group{
+		Engine: g.Engine.With(middlewares...),
+		prefix: g.prefix + prefix,
+		path:   g.path + prefix,
+		cors:   g.cors,
+	}
+}
+
+// Mount - creates a standalone sub-router mounted under the current prefix
+func (g *Group) Mount(prefix string, middlewares ...Middleware) *Group {
+	sub := mount(g.Engine, g.prefix+cleanPrefix(prefix), middlewares)
+	sub.path = g.path + cleanPrefix(prefix)
+	sub.cors = g.cors
+	return sub
+}
+
+// Version - convenience to create a nested versioned group
+func (g *Group) Version(version string, middlewares ...Middleware) *Group {
+	return g.Group(version, middlewares...)
+}
+
+// Routes - returns the list of routes registered within the group, routes of a
+// mounted group are relative to its mount point
+func (g *Group) Routes() []Route {
+	routes := walkRoutes(g.Engine)
+	if g.prefix == "" {
+		return routes
+	}
+	var list []Route
+	for _, r := range routes {
+		if r.Pattern == g.prefix || strings.HasPrefix(r.Pattern, g.prefix+"/") {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// Handle - attach a plain http.Handler to all methods of a route
+func (g *Group) Handle(route string, handler http.Handler) {
+	g.Engine.Handle(g.prefix+route, handler)
+}
+
+// Get - implementation of http get
+func (g *Group) Get(route string, handler http.HandlerFunc) {
+	g.Engine.Get(g.prefix+route, handler)
+}
+
+// Patch - implementation of http patch
+func (g *Group) Patch(route string, handler http.HandlerFunc) {
+	g.Engine.Patch(g.prefix+route, handler)
+}
+
+// Put - implementation of http put
+func (g *Group) Put(route string, handler http.HandlerFunc) {
+	g.Engine.Put(g.prefix+route, handler)
+}
+
+// Post - implementation of http post
+func (g *Group) Post(route string, handler http.HandlerFunc) {
+	g.Engine.Post(g.prefix+route, handler)
+}
+
+// Delete - implementation of http delete
+func (g *Group) Delete(route string, handler http.HandlerFunc) {
+	g.Engine.Delete(g.prefix+route, handler)
+}
+
+func mount(parent chi.Router, prefix string, middlewares []Middleware) *Group {
+	sub := chi.NewRouter()
+	sub.Use(middlewares...)
+	parent.Mount(prefix, sub)
+	return &Group{Engine: sub, path: prefix}
+}
+
+// cleanPrefix makes sure a prefix starts with a single slash and has no trailing
+// slash or wildcard, an empty prefix stays empty
+func cleanPrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/*")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + strings.TrimLeft(prefix, "/")
+}
+
+func walkRoutes(r chi.Routes) []Route {
+	var list []Route
+	chi.Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// chi keeps the mount wildcard in nested patterns, strip it for readability
+		route = strings.Replace(route, "/*/", "/", -1)
+		list = append(list, Route{
+			Method:      method,
+			Pattern:     route,
+			Middlewares: len(middlewares),
+		})
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Pattern == list[j].Pattern {
+			return list[i].Method < list[j].Method
+		}
+		return list[i].Pattern < list[j].Pattern
+	})
+	return list
+}
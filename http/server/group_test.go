@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Mw", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	router.Get("/health", ok)
+	v1 := router.Version("v1", mark("v1"))
+	v1.Get("/users", ok)
+	admin := v1.Group("/admin/", mark("admin"))
+	admin.Post("/users", ok)
+	v2 := router.Mount("/v2", mark("v2"))
+	v2.Get("/users", ok)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		mw     []string
+	}{
+		{"GET", "/health", http.StatusOK, nil},
+		{"GET", "/v1/users", http.StatusOK, []string{"v1"}},
+		{"POST", "/v1/admin/users", http.StatusOK, []string{"v1", "admin"}},
+		{"GET", "/v2/users", http.StatusOK, []string{"v2"}},
+		{"GET", "/v1/admin/users", http.StatusMethodNotAllowed, nil},
+		{"GET", "/v3/users", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		resp := httptest.NewRecorder()
+		router.Engine.ServeHTTP(resp, req)
+		if resp.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, resp.Code)
+		}
+		if tt.mw == nil {
+			continue
+		}
+		got := resp.Header().Values("X-Mw")
+		if len(got) != len(tt.mw) {
+			t.Errorf("%s %s: expected middlewares %v, got %v", tt.method, tt.path, tt.mw, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.mw[i] {
+				t.Errorf("%s %s: expected middlewares %v, got %v", tt.method, tt.path, tt.mw, got)
+			}
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.Get("/b", ok)
+	router.Post("/a", ok)
+	router.Get("/a", ok)
+	router.Mount("/v2").Delete("/items/{id}", ok)
+	v1 := router.Version("/v1")
+	v1.Put("/items", ok)
+
+	expect := []Route{
+		{Method: "GET", Pattern: "/a"},
+		{Method: "POST", Pattern: "/a"},
+		{Method: "GET", Pattern: "/b"},
+		{Method: "PUT", Pattern: "/v1/items"},
+		{Method: "DELETE", Pattern: "/v2/items/{id}"},
+	}
+	routes := router.Routes()
+	if len(routes) != len(expect) {
+		t.Fatalf("Expected %d routes, got %v", len(expect), routes)
+	}
+	for i, r := range routes {
+		if r.Method != expect[i].Method || r.Pattern != expect[i].Pattern {
+			t.Errorf("Expected route %v, got %v", expect[i], r)
+		}
+	}
+
+	groupRoutes := v1.Routes()
+	if len(groupRoutes) != 1 || groupRoutes[0].Pattern != "/v1/items" {
+		t.Errorf("Expected only /v1/items in group, got %v", groupRoutes)
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IdempotencyStore - storage used by the idempotency middleware, both MemoryStore
+// and github.com/kelchy/go-lib/redis Client satisfy it, the latter sharing
+// responses and in-flight locks across instances
+type IdempotencyStore interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) (string, error)
+	Lock(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, key string) (bool, error)
+}
+
+// IdempotencyOptions - options for the idempotency middleware
+type IdempotencyOptions struct {
+	// Header - request header carrying the key, defaults to Idempotency-Key
+	Header string
+	// Methods - methods the middleware applies to, defaults to POST and PATCH
+	Methods []string
+	// TTL - how long responses are kept for replay, defaults to 24h
+	TTL time.Duration
+	// LockTTL - expiry of the in-flight lock in case the instance dies, defaults to 1m
+	LockTTL time.Duration
+	// Principal - scopes keys to the caller, defaults to GetPrincipal
+	Principal func(r *http.Request) string
+	// Required - reject requests without a key with 400
+	Required bool
+	// MaxKeyLength - longer keys are rejected with 400, defaults to 255
+	MaxKeyLength int
+	// MaxBodySize - the body is buffered to be hashed, larger ones are rejected
+	// with 413, defaults to 1MB
+	MaxBodySize int64
+}
+
+// idempotencyRecord - stored response replayed on retries
+type idempotencyRecord struct {
+	Hash   string      `json:"hash"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Idempotency - middleware storing the first response of a request carrying an
+// Idempotency-Key and replaying it on retries, keys are scoped by method, path and
+// principal, concurrent duplicates get 409 and a reused key with a different
+// payload gets 422, server errors are not stored so the request can be retried
+func Idempotency(store IdempotencyStore, opts IdempotencyOptions) Middleware {
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = time.Minute
+	}
+	if opts.Principal == nil {
+		opts.Principal = GetPrincipal
+	}
+	if opts.MaxKeyLength <= 0 {
+		opts.MaxKeyLength = 255
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !containsFold(opts.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.Header.Get(opts.Header)
+			if key == "" {
+				if opts.Required {
+					writeError(w, http.StatusBadRequest, "Missing "+opts.Header+" header")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > opts.MaxKeyLength {
+				writeError(w, http.StatusBadRequest, "Invalid "+opts.Header+" header")
+				return
+			}
+
+			body, e := io.ReadAll(io.LimitReader(r.Body, opts.MaxBodySize+1))
+			if e != nil {
+				writeError(w, http.StatusBadRequest, "Unable to read request body")
+				return
+			}
+			if int64(len(body)) > opts.MaxBodySize {
+				writeError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			hash := hex.EncodeToString(sum[:])
+			scope := sha256.Sum256([]byte(strings.Join([]string{opts.Principal(r), r.Method, r.URL.Path, key}, "\n")))
+			storeKey := "idempotency_" + hex.EncodeToString(scope[:])
+
+			ctx := r.Context()
+			if replayed, e := replayIdempotent(ctx, store, storeKey, hash, w); replayed || e != nil {
+				if e != nil {
+					writeError(w, http.StatusServiceUnavailable, "Idempotency store unavailable")
+				}
+				return
+			}
+			locked, e := store.Lock(ctx, storeKey, opts.LockTTL)
+			if e != nil {
+				writeError(w, http.StatusServiceUnavailable, "Idempotency store unavailable")
+				return
+			}
+			if !locked {
+				// the first request may have completed in between
+				if replayed, _ := replayIdempotent(ctx, store, storeKey, hash, w); !replayed {
+					writeError(w, http.StatusConflict, "A request with the same "+opts.Header+" is in progress")
+				}
+				return
+			}
+			// the lock is released even if the request context got cancelled
+			defer store.Unlock(context.Background(), storeKey)
+			// the first request may have stored its response and released the
+			// lock between the lookup above and Lock
+			if replayed, e := replayIdempotent(ctx, store, storeKey, hash, w); replayed || e != nil {
+				if e != nil {
+					writeError(w, http.StatusServiceUnavailable, "Idempotency store unavailable")
+				}
+				return
+			}
+
+			rw := &recordWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+			if rw.hijacked || rw.status >= http.StatusInternalServerError {
+				return
+			}
+			rec, _ := json.Marshal(idempotencyRecord{
+				Hash:   hash,
+				Status: rw.status,
+				Header: replayHeader(w.Header()),
+				Body:   rw.body.Bytes(),
+			})
+			store.Set(context.Background(), storeKey, string(rec), opts.TTL)
+		})
+	}
+}
+
+// replayIdempotent writes a stored response, 422 is sent when the stored request
+// had a different payload
+func replayIdempotent(ctx context.Context, store IdempotencyStore, key string, hash string, w http.ResponseWriter) (bool, error) {
+	raw, e := store.Get(ctx, key)
+	if e != nil || raw == "" {
+		return false, e
+	}
+	var rec idempotencyRecord
+	if e := json.Unmarshal([]byte(raw), &rec); e != nil {
+		return false, e
+	}
+	if rec.Hash != hash {
+		writeError(w, http.StatusUnprocessableEntity, "Idempotency key reused with a different payload")
+		return true, nil
+	}
+	hdr := w.Header()
+	for k, v := range rec.Header {
+		hdr[k] = v
+	}
+	hdr.Set("Idempotent-Replayed", "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+	return true, nil
+}
+
+// replayHeader copies the response headers to store, CORS headers are left out
+// as they belong to the caller and are set again by the CORS middleware
+func replayHeader(h http.Header) http.Header {
+	out := http.Header{}
+	for k, v := range h {
+		if k == "Vary" || strings.HasPrefix(k, "Access-Control-") {
+			continue
+		}
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+// recordWriter passes the response through while keeping a copy of it
+type recordWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	hijacked    bool
+	body        bytes.Buffer
+}
+
+func (rw *recordWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.body.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
+
+// Flush - passes flushes through to the underlying writer
+func (rw *recordWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack - allows connection upgrades to pass through, nothing is recorded
+func (rw *recordWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("record: underlying writer does not support hijack")
+	}
+	rw.hijacked = true
+	return h.Hijack()
+}
+
+// Unwrap - exposes the underlying writer to http.ResponseController
+func (rw *recordWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func containsFold(s []string, str string) bool {
+	for _, v := range s {
+		if strings.EqualFold(v, str) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, SetPrincipal(r, r.Header.Get("X-User")))
+		})
+	})
+	router.Use(Idempotency(NewMemoryStore(), IdempotencyOptions{}))
+
+	var orders int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router.Post("/orders", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Slow") != "" {
+			close(started)
+			<-release
+		}
+		n := atomic.AddInt32(&orders, 1)
+		w.Header().Set("X-Order", strconv.Itoa(int(n)))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":` + strconv.Itoa(int(n)) + `}`))
+	})
+	router.Post("/fail", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&orders, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	do := func(path, key, user, body string, hdr ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		req.Header.Set("X-User", user)
+		for i := 0; i+1 < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		resp := httptest.NewRecorder()
+		router.Engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	first := do("/orders", "k1", "alice", `{"item":1}`)
+	if first.Code != http.StatusCreated || first.Body.String() != `{"id":1}` {
+		t.Fatalf("Unexpected first response %d %s", first.Code, first.Body.String())
+	}
+	retry := do("/orders", "k1", "alice", `{"item":1}`)
+	if retry.Code != http.StatusCreated || retry.Body.String() != `{"id":1}` || retry.Header().Get("X-Order") != "1" {
+		t.Fatalf("Expected replayed response, got %d %s", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatal("Expected replay marker header")
+	}
+	if resp := do("/orders", "k1", "alice", `{"item":2}`); resp.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422 for mismatched payload, got %d", resp.Code)
+	}
+	if resp := do("/orders", "k1", "bob", `{"item":1}`); resp.Body.String() != `{"id":2}` {
+		t.Fatalf("Expected keys to be scoped by principal, got %s", resp.Body.String())
+	}
+	if resp := do("/orders", "", "bob", `{"item":1}`); resp.Body.String() != `{"id":3}` {
+		t.Fatalf("Expected request without key to pass through, got %s", resp.Body.String())
+	}
+
+	// server errors are not stored
+	do("/fail", "k2", "alice", "")
+	do("/fail", "k2", "alice", "")
+	if n := atomic.LoadInt32(&orders); n != 5 {
+		t.Fatalf("Expected failed requests to be retried, got %d calls", n)
+	}
+
+	// concurrent duplicate while the first is in flight
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- do("/orders", "k3", "alice", `{}`, "X-Slow", "1")
+	}()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Slow request did not start")
+	}
+	dup := do("/orders", "k3", "alice", `{}`)
+	close(release)
+	if dup.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for in-flight duplicate, got %d", dup.Code)
+	}
+	if resp := <-done; resp.Code != http.StatusCreated {
+		t.Fatalf("Expected in-flight request to complete, got %d", resp.Code)
+	}
+}
+
+func TestIdempotencyRequired(t *testing.T) {
+	h := Idempotency(NewMemoryStore(), IdempotencyOptions{Required: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/", nil))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 without key, got %d", resp.Code)
+	}
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected safe methods to pass through, got %d", resp.Code)
+	}
+}
+
+// racyStore runs beforeLock once ahead of the first Lock, simulating a request
+// completing between the lookup and the lock of another
+type racyStore struct {
+	*MemoryStore
+	beforeLock func()
+}
+
+func (s *racyStore) Lock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if f := s.beforeLock; f != nil {
+		s.beforeLock = nil
+		f()
+	}
+	return s.MemoryStore.Lock(ctx, key, ttl)
+}
+
+func TestIdempotencyCompletedBeforeLock(t *testing.T) {
+	var orders int32
+	store := &racyStore{MemoryStore: NewMemoryStore()}
+	h := Idempotency(store, IdempotencyOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&orders, 1)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strconv.Itoa(int(n))))
+	}))
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "k1")
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+	// the first request stores its response and unlocks between the lookup
+	// and the lock of the second one
+	var first *httptest.ResponseRecorder
+	store.beforeLock = func() { first = do() }
+	second := do()
+	if n := atomic.LoadInt32(&orders); n != 1 {
+		t.Fatalf("Expected the handler to run once, got %d calls", n)
+	}
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated || second.Body.String() != "1" || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("Expected the second request to replay the first, got %d %s", second.Code, second.Body.String())
+	}
+}
+
+func TestIdempotencyLimits(t *testing.T) {
+	cors := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+			w.Header().Add("Vary", "Origin")
+			next.ServeHTTP(w, r)
+		})
+	}
+	h := cors(Idempotency(NewMemoryStore(), IdempotencyOptions{MaxBodySize: 8})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Order", "1")
+		w.WriteHeader(http.StatusCreated)
+	})))
+	do := func(origin, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "k1")
+		req.Header.Set("Origin", origin)
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+	if resp := do("https://a.example.com", strings.Repeat("x", 9)); resp.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 for a large body, got %d", resp.Code)
+	}
+	do("https://a.example.com", "{}")
+	resp := do("https://b.example.com", "{}")
+	if resp.Header().Get("Idempotent-Replayed") != "true" || resp.Header().Get("X-Order") != "1" {
+		t.Fatalf("Expected replayed response, got %v", resp.Header())
+	}
+	if got := resp.Header().Get("Access-Control-Allow-Origin"); got != "https://b.example.com" || len(resp.Header().Values("Vary")) != 1 {
+		t.Fatalf("Expected CORS headers of the current caller, got %s %v", got, resp.Header().Values("Vary"))
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout - middleware cancelling the request context after d and replying 504
+// if the handler has not finished by then, the handler keeps running in the
+// background until it notices the cancellation so it must honour r.Context(),
+// websocket upgrades and event streams are passed through untouched
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d <= 0 || isUpgrade(r) || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: http.Header{}, status: http.StatusOK}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if rc := recover(); rc != nil {
+						panicked <- rc
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case rc := <-panicked:
+				// re-panic in the serving goroutine so catchall recovers it
+				panic(rc)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				hdr := w.Header()
+				for k, v := range tw.header {
+					hdr[k] = v
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if ctx.Err() == context.DeadlineExceeded {
+					writeError(w, http.StatusGatewayTimeout, "Request timed out")
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response so nothing reaches the client once the
+// deadline fired, writes after the timeout fail with http.ErrHandlerTimeout
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.status = code
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return tw.body.Write(p)
+}
+
+// MaxBodySize - middleware limiting the request body to n bytes, requests
+// announcing a bigger body get 413 right away, otherwise reading past the
+// limit returns an error to the handler
+func MaxBodySize(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if n > 0 && r.Body != nil && r.Body != http.NoBody {
+				if r.ContentLength > n {
+					writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", n))
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConcurrencyLimit - middleware allowing at most n requests in flight and
+// shedding the rest with 503, the limit is shared by every route the returned
+// middleware is applied to, so call it once per route for per route limits
+func ConcurrencyLimit(n int) Middleware {
+	if n <= 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+	sem := make(chan struct{}, n)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusServiceUnavailable, "Server is busy, please retry")
+			}
+		})
+	}
+}
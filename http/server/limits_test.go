@@ -0,0 +1,123 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	router, err := NewWithOptions(Options{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	cancelled := make(chan struct{})
+	router.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+		w.Write([]byte("late"))
+	})
+	router.Get("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Fast", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	})
+	router.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	resp := httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, httptest.NewRequest("GET", "/slow", nil))
+	if resp.Code != http.StatusGatewayTimeout {
+		t.Fatalf("Expected 504, got %d", resp.Code)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected handler context to be cancelled")
+	}
+
+	resp = httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, httptest.NewRequest("GET", "/fast", nil))
+	if resp.Code != http.StatusCreated || resp.Body.String() != "ok" || resp.Header().Get("X-Fast") != "1" {
+		t.Fatalf("Unexpected fast response %d %q", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, httptest.NewRequest("GET", "/panic", nil))
+	if resp.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected panic to be recovered with 500, got %d", resp.Code)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	router, err := NewWithOptions(Options{MaxBodySize: 8})
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		body   string
+		length bool
+		status int
+	}{
+		{"small", true, http.StatusOK},
+		{"way too large", true, http.StatusRequestEntityTooLarge},
+		{"way too large", false, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		if !tt.length {
+			req.ContentLength = -1
+		}
+		resp := httptest.NewRecorder()
+		router.Engine.ServeHTTP(resp, req)
+		if resp.Code != tt.status {
+			t.Errorf("Body %q (length %v): expected %d, got %d", tt.body, tt.length, tt.status, resp.Code)
+		}
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	limited := router.Group("", ConcurrencyLimit(1))
+	limited.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	done := make(chan int)
+	go func() {
+		resp := httptest.NewRecorder()
+		router.Engine.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+		done <- resp.Code
+	}()
+	<-started
+	resp := httptest.NewRecorder()
+	router.Engine.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	close(release)
+	if resp.Code != http.StatusServiceUnavailable || resp.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 503 with Retry-After when saturated, got %d", resp.Code)
+	}
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("Expected first request to succeed, got %d", code)
+	}
+}
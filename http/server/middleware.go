@@ -2,10 +2,9 @@ package server
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/urfave/negroni"
@@ -15,38 +14,55 @@ func (rtr *Router) catchall(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t1 := time.Now()
 		w2 := negroni.NewResponseWriter(w)
+		r = withRequestInfo(rtr.lifecycle.inject(r))
+		body := rtr.countBody(r)
 		// defer is first in last out, this will run if in case any
 		// uncaught panic happens within the api logic, except if
 		// it happens within another go routine created within
 		defer func() {
 			rc := recover()
-			diff := float64(time.Since(t1).Microseconds()) / 1000
-			diffStr := fmt.Sprintf("%f", diff)
 			if rc != nil {
-				rtr.log.Error("HTTPS_MW", errors.New("Uncaught Exception: "+rc.(error).Error()))
+				rtr.log.Error("HTTPS_MW", fmt.Errorf("Uncaught Exception: %v", rc))
+				// a response already on its way (or a hijacked connection) can't be replaced
+				if w2.Written() || isUpgrade(r) {
+					return
+				}
 				// build generic 500 error
-				jsonBody, _ := json.Marshal(map[string]string{
-					"error": "There was an internal server error",
-				})
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write(jsonBody)
+				writeError(w, http.StatusInternalServerError, "There was an internal server error")
 			} else if rtr.logRequest {
-				if !contains(rtr.logSkipPath, r.URL.Path) {
-					msg, _ := json.Marshal(map[string]string{
-						"method": r.Method,
-						"status": strconv.Itoa(w2.Status()),
-						"src":    r.RemoteAddr,
-						"ms":     diffStr,
-					})
-					rtr.log.Out(r.URL.Path, string(msg))
-				}
+				rtr.logAccess(r, w2, t1, body)
 			}
 		}()
 		next.ServeHTTP(w2, r)
 	})
 }
 
+// status returns the response status, handlers that never write get the implicit
+// 200 while upgraded connections are hijacked before negroni sees the 101
+func status(w negroni.ResponseWriter, r *http.Request) int {
+	if w.Written() {
+		return w.Status()
+	}
+	if isUpgrade(r) {
+		return http.StatusSwitchingProtocols
+	}
+	return http.StatusOK
+}
+
+func isUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// writeError sends the generic json error body used by the middlewares
+func writeError(w http.ResponseWriter, status int, msg string) {
+	jsonBody, _ := json.Marshal(map[string]string{
+		"error": msg,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonBody)
+}
+
 func contains(s []string, str string) bool {
 	for _, v := range s {
 		if v == str {
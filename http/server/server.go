@@ -3,10 +3,11 @@ package server
 import (
 	"errors"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
-	"github.com/go-chi/cors"
 	"github.com/kelchy/go-lib/log"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
@@ -21,13 +22,22 @@ type Router struct {
 	log         log.Log
 	logRequest  bool
 	logSkipPath []string
+	accessLog   *accessLog
+	lifecycle   *lifecycle
+	cors        *corsHandler
 }
 
-// CorsOptions takes in the options for CORS
-type CorsOptions struct {
-	Origins           []string
-	Headers           []string
-	AllowedOriginFunc func(r *http.Request, origin string) bool
+// Options - options applied when constructing the router, the limits apply to
+// every route, stricter per route limits can be set on groups with the
+// Timeout, MaxBodySize and ConcurrencyLimit middlewares
+type Options struct {
+	Cors *CorsOptions
+	// Timeout - deadline of every request, 504 is returned when exceeded
+	Timeout time.Duration
+	// MaxBodySize - maximum request body size in bytes
+	MaxBodySize int64
+	// MaxConcurrent - maximum requests in flight, excess requests get 503
+	MaxConcurrent int
 }
 
 // New - constructor function to initialize an instance
@@ -42,7 +52,16 @@ func New(origins []string, headers []string) (*Router, error) {
 
 // NewWithCorsOptions - constructor function to initialize with cors options
 func NewWithCorsOptions(corsOptions *CorsOptions) (*Router, error) {
+	return NewWithOptions(Options{Cors: corsOptions})
+}
+
+// NewWithOptions - constructor function to initialize with cors options and limits
+func NewWithOptions(opts Options) (*Router, error) {
 	var rtr Router
+	corsOptions := opts.Cors
+	if corsOptions == nil {
+		corsOptions = &CorsOptions{}
+	}
 
 	l, e := log.New("")
 	if e != nil {
@@ -50,33 +69,25 @@ func NewWithCorsOptions(corsOptions *CorsOptions) (*Router, error) {
 	}
 	rtr.log = l
 	rtr.logRequest = true
+	rtr.lifecycle = newLifecycle()
 
 	// by default middleware don't log root path which is
 	// usually used by health checks
 	rtr.logSkipPath = []string{"/"}
-	origins := corsOptions.Origins
-	if len(origins) == 0 {
-		origins = []string{"http://localhost", "https://localhost"}
-	}
-	allowedDefault := []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"}
-	headers := corsOptions.Headers
-	if len(headers) == 0 {
-		headers = allowedDefault
-	} else {
-		headers = append(headers, allowedDefault...)
-	}
+	rtr.cors = newCorsHandler(*corsOptions)
 	rtr.Engine = chi.NewRouter()
-	rtr.Engine.Use(cors.Handler(cors.Options{
-		AllowOriginFunc:  corsOptions.AllowedOriginFunc,
-		AllowedOrigins:   origins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   headers,
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           12 * 60 * 60,
-	}))
+	rtr.Engine.Use(rtr.cors.handler)
 	rtr.Engine.Use(middleware.RealIP)
 	rtr.Engine.Use(rtr.catchall)
+	if opts.MaxBodySize > 0 {
+		rtr.Engine.Use(MaxBodySize(opts.MaxBodySize))
+	}
+	if opts.MaxConcurrent > 0 {
+		rtr.Engine.Use(ConcurrencyLimit(opts.MaxConcurrent))
+	}
+	if opts.Timeout > 0 {
+		rtr.Engine.Use(Timeout(opts.Timeout))
+	}
 	return &rtr, nil
 }
 
@@ -88,7 +99,8 @@ func (rtr *Router) SetLogger(logtype string) {
 	}
 }
 
-// SetLogSkipPath - changes the middleware logging behaviour
+// SetLogSkipPath - changes the middleware logging behaviour, glob patterns
+// such as /static/* are supported
 func (rtr *Router) SetLogSkipPath(list []string) {
 	rtr.logSkipPath = list
 }
@@ -98,16 +110,16 @@ func (rtr *Router) SetLogRequest(lr bool) {
 	rtr.logRequest = lr
 }
 
-// Run - run and listen for http
+// Run - run and listen for http, returns nil once stopped with Shutdown
 func (rtr Router) Run(proto string, hostport string) error {
 	rtr.log.Out("SERVER_RUN", "Listening "+proto+" "+hostport)
 	var e error
 	if proto == "http" {
-		e = http.ListenAndServe(hostport, rtr.Engine)
+		e = rtr.listen(&http.Server{Addr: hostport, Handler: rtr.Engine}, "", "")
 	} else if proto == "h2c" {
 		// h2c denotes http/2 in cleartext, useful in cases where API GW strips encryption
 		h2s := &http2.Server{}
-		http.ListenAndServe(hostport, h2c.NewHandler(rtr.Engine, h2s))
+		e = rtr.listen(&http.Server{Addr: hostport, Handler: h2c.NewHandler(rtr.Engine, h2s)}, "", "")
 	} else {
 		e = errors.New("Unknown Proto")
 	}
@@ -117,12 +129,12 @@ func (rtr Router) Run(proto string, hostport string) error {
 	return e
 }
 
-// RunS - run and listen for https
+// RunS - run and listen for https, returns nil once stopped with Shutdown
 func (rtr Router) RunS(proto string, hostport string, crt string, key string) error {
 	rtr.log.Out("SERVER_RUNS", "Listening "+proto+" "+hostport)
 	var e error
 	if proto == "https" {
-		e = http.ListenAndServeTLS(hostport, crt, key, rtr.Engine)
+		e = rtr.listen(&http.Server{Addr: hostport, Handler: rtr.Engine}, crt, key)
 	} else if proto == "h2" {
 		// TODO: add h2
 	} else {
@@ -134,25 +146,32 @@ func (rtr Router) RunS(proto string, hostport string, crt string, key string) er
 	return e
 }
 
-// Static - function to handle and serve static files within a directory on live system
+func (rtr Router) listen(srv *http.Server, crt string, key string) error {
+	if rtr.lifecycle != nil {
+		rtr.lifecycle.track(srv)
+	}
+	var e error
+	if crt != "" || key != "" {
+		e = srv.ListenAndServeTLS(crt, key)
+	} else {
+		e = srv.ListenAndServe()
+	}
+	if e == http.ErrServerClosed {
+		return nil
+	}
+	return e
+}
+
+// Static - function to handle and serve static files within a directory on live system,
+// directory listing is disabled, use ServeFS for more options
 func (rtr Router) Static(urlPath string, dirPath string) {
-	// do not use wildcard (*) in urlPath
-	rtr.Engine.Handle(urlPath+"*", http.StripPrefix(urlPath, http.FileServer(http.Dir(dirPath))))
-	// TODO: handle wildcards better
+	rtr.ServeFS(urlPath, os.DirFS(dirPath), StaticOptions{})
 }
 
-// StaticFs - function to handle and serve static files embedded into binary using esc
+// StaticFs - function to handle and serve static files from a http.FileSystem, the
+// filesystem is expected to contain urlPath as it is not stripped from the request
+// Deprecated: use ServeFS with an embed.FS or any other fs.FS instead
 func (rtr Router) StaticFs(urlPath string, fs http.FileSystem) {
-	/*
-		generate a boxed static filesystem by using esc (https://github.com/mjibson/esc):
-			~/go/bin/esc -o static/static.go -pkg static -ignore=".*.go" ./static
-		on your project's home dir, use it like this:
-			var rtr server.Router
-			rtr.New([]string{})
-			rtr.StaticFs("/static/", static.FS(false))
-		static.FS() returns a standard http.FileSystem which you can pass to this function
-	*/
-	// do not use wildcard (*) in urlPath
-	rtr.Engine.Handle(urlPath+"*", http.FileServer(fs))
-	// TODO: handle wildcards better
+	prefix := cleanPrefix(urlPath)
+	rtr.Engine.Handle(prefix+"/*", http.FileServer(fs))
 }
@@ -0,0 +1,269 @@
+package servertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// GoldenDir - directory of the golden files, relative to the package under test
+var GoldenDir = "testdata"
+
+// UpdateGoldenEnv - environment variable that rewrites golden files when set to
+// a non empty value, e.g. UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+// Matcher - custom check of a value for JSONPath, returns false when not matching
+type Matcher func(v interface{}) bool
+
+// NotEmpty - matches any value other than null, false, 0, "" and empty arrays or objects
+var NotEmpty Matcher = func(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	case []interface{}:
+		return len(x) > 0
+	case map[string]interface{}:
+		return len(x) > 0
+	}
+	return true
+}
+
+// Response - recorded response with chainable assertions, failed assertions are
+// reported with t.Errorf so every mismatch of a chain shows up
+type Response struct {
+	t    testing.TB
+	name string
+	// Recorder - the raw recorded response
+	Recorder *httptest.ResponseRecorder
+}
+
+// Status - asserts the status code
+func (res *Response) Status(code int) *Response {
+	res.t.Helper()
+	if res.Recorder.Code != code {
+		res.t.Errorf("%s: expected status %d, got %d, body: %s", res.name, code, res.Recorder.Code, res.Recorder.Body.String())
+	}
+	return res
+}
+
+// Header - asserts the value of a response header, empty asserts its absence
+func (res *Response) Header(key string, value string) *Response {
+	res.t.Helper()
+	if got := res.Recorder.Header().Get(key); got != value {
+		res.t.Errorf("%s: expected header %s %q, got %q", res.name, key, value, got)
+	}
+	return res
+}
+
+// Body - asserts the exact body
+func (res *Response) Body(body string) *Response {
+	res.t.Helper()
+	if got := res.Recorder.Body.String(); got != body {
+		res.t.Errorf("%s: expected body %q, got %q", res.name, body, got)
+	}
+	return res
+}
+
+// BodyContains - asserts the body contains s
+func (res *Response) BodyContains(s string) *Response {
+	res.t.Helper()
+	if !strings.Contains(res.Recorder.Body.String(), s) {
+		res.t.Errorf("%s: expected body to contain %q, got %q", res.name, s, res.Recorder.Body.String())
+	}
+	return res
+}
+
+// JSON - asserts the body is json equal to v, key order and formatting are ignored
+func (res *Response) JSON(v interface{}) *Response {
+	res.t.Helper()
+	got, e := res.decoded()
+	if e != nil {
+		res.t.Errorf("%s: %v", res.name, e)
+		return res
+	}
+	want, e := normalize(v)
+	if e != nil {
+		res.t.Errorf("%s: unable to encode expected value: %v", res.name, e)
+		return res
+	}
+	if !reflect.DeepEqual(got, want) {
+		res.t.Errorf("%s: expected json %s, got %s", res.name, mustJSON(want), res.Recorder.Body.String())
+	}
+	return res
+}
+
+// JSONPath - asserts the value at path, e.g. $.items[0].id, expected is compared
+// as json so 1 matches 1.0, pass a Matcher for custom checks
+func (res *Response) JSONPath(path string, expected interface{}) *Response {
+	res.t.Helper()
+	doc, e := res.decoded()
+	if e != nil {
+		res.t.Errorf("%s: %v", res.name, e)
+		return res
+	}
+	got, e := lookup(doc, path)
+	if e != nil {
+		res.t.Errorf("%s: %s: %v", res.name, path, e)
+		return res
+	}
+	if f, ok := expected.(func(v interface{}) bool); ok {
+		expected = Matcher(f)
+	}
+	if m, ok := expected.(Matcher); ok {
+		if !m(got) {
+			res.t.Errorf("%s: %s: unexpected value %s", res.name, path, mustJSON(got))
+		}
+		return res
+	}
+	want, e := normalize(expected)
+	if e != nil {
+		res.t.Errorf("%s: unable to encode expected value: %v", res.name, e)
+		return res
+	}
+	if !reflect.DeepEqual(got, want) {
+		res.t.Errorf("%s: %s: expected %s, got %s", res.name, path, mustJSON(want), mustJSON(got))
+	}
+	return res
+}
+
+// Decode - decodes the json body into v
+func (res *Response) Decode(v interface{}) *Response {
+	res.t.Helper()
+	if e := json.Unmarshal(res.Recorder.Body.Bytes(), v); e != nil {
+		res.t.Errorf("%s: unable to decode body: %v", res.name, e)
+	}
+	return res
+}
+
+// Golden - compares the status and body with GoldenDir/name.golden, json bodies
+// are indented with sorted keys so snapshots are stable and easy to review, set
+// UPDATE_GOLDEN to write the current response instead
+func (res *Response) Golden(name string) *Response {
+	res.t.Helper()
+	snapshot := res.snapshot()
+	file := filepath.Join(GoldenDir, name+".golden")
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if e := os.MkdirAll(filepath.Dir(file), 0755); e != nil {
+			res.t.Fatalf("%s: unable to create golden dir: %v", res.name, e)
+		}
+		if e := os.WriteFile(file, snapshot, 0644); e != nil {
+			res.t.Fatalf("%s: unable to write golden file: %v", res.name, e)
+		}
+		return res
+	}
+	want, e := os.ReadFile(file)
+	if e != nil {
+		res.t.Errorf("%s: unable to read golden file, run with %s=1 to create it: %v", res.name, UpdateGoldenEnv, e)
+		return res
+	}
+	if !bytes.Equal(want, snapshot) {
+		res.t.Errorf("%s: response differs from %s\n--- want\n%s\n--- got\n%s", res.name, file, want, snapshot)
+	}
+	return res
+}
+
+func (res *Response) snapshot() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d\n", res.Recorder.Code)
+	body := res.Recorder.Body.Bytes()
+	var v interface{}
+	if json.Unmarshal(body, &v) == nil {
+		body, _ = json.MarshalIndent(v, "", "  ")
+	}
+	buf.Write(body)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func (res *Response) decoded() (interface{}, error) {
+	var v interface{}
+	if e := json.Unmarshal(res.Recorder.Body.Bytes(), &v); e != nil {
+		return nil, fmt.Errorf("body is not json: %v", e)
+	}
+	return v, nil
+}
+
+// normalize turns v into the generic form produced by json.Unmarshal
+func normalize(v interface{}) (interface{}, error) {
+	raw, e := json.Marshal(v)
+	if e != nil {
+		return nil, e
+	}
+	var out interface{}
+	e = json.Unmarshal(raw, &out)
+	return out, e
+}
+
+func mustJSON(v interface{}) string {
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
+
+// lookup resolves a small subset of JSONPath: $, .key, ['key'] and [index]
+func lookup(doc interface{}, path string) (interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with $")
+	}
+	cur := doc
+	p := path[1:]
+	for p != "" {
+		var key string
+		index := -1
+		switch {
+		case p[0] == '.':
+			end := strings.IndexAny(p[1:], ".[")
+			if end < 0 {
+				end = len(p) - 1
+			}
+			key, p = p[1:end+1], p[end+1:]
+		case strings.HasPrefix(p, "['"):
+			end := strings.Index(p, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key")
+			}
+			key, p = p[2:end], p[end+2:]
+		case p[0] == '[':
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index")
+			}
+			i, e := strconv.Atoi(p[1:end])
+			if e != nil {
+				return nil, fmt.Errorf("invalid index %q", p[1:end])
+			}
+			index, p = i, p[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", p)
+		}
+		if index >= 0 {
+			arr, ok := cur.([]interface{})
+			if !ok || index >= len(arr) {
+				return nil, fmt.Errorf("index %d not found", index)
+			}
+			cur = arr[index]
+			continue
+		}
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("key %q not found", key)
+		}
+		if cur, ok = obj[key]; !ok {
+			return nil, fmt.Errorf("key %q not found", key)
+		}
+	}
+	return cur, nil
+}
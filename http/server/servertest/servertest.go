@@ -0,0 +1,243 @@
+// Package servertest - fluent helpers to test a server.Router without a listener
+//
+//	servertest.New(rtr).Post("/widgets").JSON(body).Header("X-Tenant-ID", "acme").
+//		Expect(t).Status(201).JSONPath("$.id", servertest.NotEmpty)
+package servertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kelchy/go-lib/http/server"
+)
+
+// Client - sends requests straight to the handler of a router, defaults set on
+// the client apply to every request built from it
+type Client struct {
+	handler   http.Handler
+	header    http.Header
+	principal string
+	tenant    *server.TenantConfig
+}
+
+// New - constructor to test a router through its full middleware stack
+func New(rtr *server.Router) *Client {
+	return NewHandler(rtr.Engine)
+}
+
+// NewHandler - constructor to test any http.Handler, e.g. a single middleware
+func NewHandler(h http.Handler) *Client {
+	return &Client{handler: h, header: http.Header{}}
+}
+
+// WithHeader - returns a copy of the client sending the header on every request
+func (c *Client) WithHeader(key string, value string) *Client {
+	c2 := c.clone()
+	c2.header.Add(key, value)
+	return c2
+}
+
+// WithPrincipal - returns a copy of the client whose requests carry the principal
+// as if an auth middleware had called server.SetPrincipal
+func (c *Client) WithPrincipal(principal string) *Client {
+	c2 := c.clone()
+	c2.principal = principal
+	return c2
+}
+
+// WithTenant - returns a copy of the client whose requests carry the tenant, the
+// server.Tenant middleware uses it instead of resolving one
+func (c *Client) WithTenant(cfg server.TenantConfig) *Client {
+	c2 := c.clone()
+	c2.tenant = &cfg
+	return c2
+}
+
+func (c *Client) clone() *Client {
+	c2 := *c
+	c2.header = c.header.Clone()
+	return &c2
+}
+
+// Get - starts a GET request
+func (c *Client) Get(path string) *Request {
+	return c.Request(http.MethodGet, path)
+}
+
+// Head - starts a HEAD request
+func (c *Client) Head(path string) *Request {
+	return c.Request(http.MethodHead, path)
+}
+
+// Options - starts an OPTIONS request
+func (c *Client) Options(path string) *Request {
+	return c.Request(http.MethodOptions, path)
+}
+
+// Post - starts a POST request
+func (c *Client) Post(path string) *Request {
+	return c.Request(http.MethodPost, path)
+}
+
+// Put - starts a PUT request
+func (c *Client) Put(path string) *Request {
+	return c.Request(http.MethodPut, path)
+}
+
+// Patch - starts a PATCH request
+func (c *Client) Patch(path string) *Request {
+	return c.Request(http.MethodPatch, path)
+}
+
+// Delete - starts a DELETE request
+func (c *Client) Delete(path string) *Request {
+	return c.Request(http.MethodDelete, path)
+}
+
+// Request - starts a request with any method
+func (c *Client) Request(method string, path string) *Request {
+	return &Request{
+		client:    c,
+		method:    method,
+		path:      path,
+		header:    c.header.Clone(),
+		query:     url.Values{},
+		principal: c.principal,
+		tenant:    c.tenant,
+		ctx:       context.Background(),
+	}
+}
+
+// Request - request being built, nothing is sent until Do or Expect
+type Request struct {
+	client    *Client
+	method    string
+	path      string
+	header    http.Header
+	query     url.Values
+	cookies   []*http.Cookie
+	body      []byte
+	err       error
+	principal string
+	tenant    *server.TenantConfig
+	ctx       context.Context
+}
+
+// Header - adds a request header
+func (r *Request) Header(key string, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+// Query - adds a query parameter
+func (r *Request) Query(key string, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Cookie - adds a cookie
+func (r *Request) Cookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// JSON - sets a json encoded body
+func (r *Request) JSON(v interface{}) *Request {
+	r.body, r.err = json.Marshal(v)
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// Form - sets an url encoded form body
+func (r *Request) Form(values url.Values) *Request {
+	r.body = []byte(values.Encode())
+	r.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// Body - sets a raw body of the given content type
+func (r *Request) Body(contentType string, body []byte) *Request {
+	r.body = body
+	r.header.Set("Content-Type", contentType)
+	return r
+}
+
+// Principal - fakes the authenticated principal of this request
+func (r *Request) Principal(principal string) *Request {
+	r.principal = principal
+	return r
+}
+
+// Tenant - fakes the tenant of this request
+func (r *Request) Tenant(cfg server.TenantConfig) *Request {
+	r.tenant = &cfg
+	return r
+}
+
+// Context - sets the context of the request
+func (r *Request) Context(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+// Build - returns the http.Request that would be sent
+func (r *Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	target := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req := httptest.NewRequest(r.method, target, body).WithContext(r.ctx)
+	for k, v := range r.header {
+		req.Header[k] = append([]string{}, v...)
+	}
+	for _, c := range r.cookies {
+		req.AddCookie(c)
+	}
+	if r.principal != "" {
+		req = server.SetPrincipal(req, r.principal)
+	}
+	if r.tenant != nil {
+		req = server.SetTenant(req, r.tenant)
+	}
+	return req, nil
+}
+
+// Do - sends the request and returns the recorded response
+func (r *Request) Do() (*httptest.ResponseRecorder, error) {
+	req, e := r.Build()
+	if e != nil {
+		return nil, e
+	}
+	rec := httptest.NewRecorder()
+	r.client.handler.ServeHTTP(rec, req)
+	return rec, nil
+}
+
+// Expect - sends the request and returns the response for assertions, failing
+// the test right away if the request can't be built
+func (r *Request) Expect(t testing.TB) *Response {
+	t.Helper()
+	rec, e := r.Do()
+	if e != nil {
+		t.Fatalf("%s %s: unable to build request: %v", r.method, r.path, e)
+	}
+	return &Response{t: t, name: r.method + " " + r.path, Recorder: rec}
+}
@@ -0,0 +1,136 @@
+package servertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/kelchy/go-lib/http/server"
+)
+
+func newRouter(t *testing.T) *server.Router {
+	rtr, err := server.New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	rtr.SetLogger("empty")
+	api := rtr.Group("/api", server.Tenant(server.TenantOptions{
+		Resolvers: []server.TenantResolver{server.TenantFromHeader("X-Tenant-ID")},
+		Store:     server.StaticTenantStore{"acme": {}},
+	}))
+	api.Post("/widgets", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if e := json.NewDecoder(r.Body).Decode(&body); e != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     "w-1",
+			"name":   body["name"],
+			"owner":  server.GetPrincipal(r),
+			"tenant": server.GetTenantID(r),
+			"tags":   []string{r.URL.Query().Get("tag")},
+		})
+	})
+	api.Post("/form", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		c, _ := r.Cookie("session")
+		fmt.Fprintf(w, "%s %s", r.PostForm.Get("name"), c.Value)
+	})
+	return rtr
+}
+
+func TestFluent(t *testing.T) {
+	api := New(newRouter(t)).WithHeader("X-Tenant-ID", "acme")
+
+	api.Post("/api/widgets").JSON(map[string]string{"name": "gear"}).Query("tag", "new").
+		Principal("user-1").
+		Expect(t).
+		Status(http.StatusCreated).
+		Header("Content-Type", "application/json").
+		JSONPath("$.id", NotEmpty).
+		JSONPath("$.name", "gear").
+		JSONPath("$.owner", "user-1").
+		JSONPath("$.tags[0]", "new").
+		JSONPath("$['tenant']", "acme").
+		Golden("widget")
+
+	api.Post("/api/form").Form(url.Values{"name": {"gear"}}).
+		Cookie(&http.Cookie{Name: "session", Value: "s1"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body("gear s1")
+
+	// a faked tenant is used as is by the tenant middleware
+	var out struct{ Tenant string }
+	New(newRouter(t)).WithTenant(server.TenantConfig{ID: "globex"}).
+		Post("/api/widgets").JSON(map[string]string{}).
+		Expect(t).
+		Decode(&out)
+	if out.Tenant != "globex" {
+		t.Errorf("Expected faked tenant, got %q", out.Tenant)
+	}
+
+	New(newRouter(t)).Post("/api/widgets").Expect(t).Status(http.StatusNotFound).
+		JSON(map[string]string{"error": "Unknown tenant"})
+}
+
+// recordingT captures failures so assertions can be tested
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertionsFail(t *testing.T) {
+	rec := &recordingT{TB: t}
+	New(newRouter(t)).WithHeader("X-Tenant-ID", "acme").
+		Post("/api/widgets").JSON(map[string]string{"name": "gear"}).
+		Expect(rec).
+		Status(http.StatusOK).
+		Header("Content-Type", "text/plain").
+		JSONPath("$.name", "bolt").
+		JSONPath("$.missing", NotEmpty).
+		JSONPath("$.tags[3]", "x").
+		BodyContains("nope")
+	if len(rec.errors) != 6 {
+		t.Fatalf("Expected 6 failures, got %d: %v", len(rec.errors), rec.errors)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"a":{"b":[{"c":1},{"d.e":"x"}]}}`), &doc)
+	tests := []struct {
+		path   string
+		expect interface{}
+		err    bool
+	}{
+		{"$", doc, false},
+		{"$.a.b[0].c", 1.0, false},
+		{"$.a.b[1]['d.e']", "x", false},
+		{"$.a.b[2]", nil, true},
+		{"$.a.x", nil, true},
+		{"a.b", nil, true},
+		{"$.a.b[x]", nil, true},
+	}
+	for _, tt := range tests {
+		got, e := lookup(doc, tt.path)
+		if (e != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.path, e)
+			continue
+		}
+		if !tt.err && mustJSON(got) != mustJSON(tt.expect) {
+			t.Errorf("%s: expected %v, got %v", tt.path, tt.expect, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// lifecycle keeps track of running servers so they can be shut down, it is
+// shared by pointer as most router methods use value receivers
+type lifecycle struct {
+	mu      sync.Mutex
+	servers []*http.Server
+	done    chan struct{}
+	once    sync.Once
+}
+
+type shutdownKey struct{}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{done: make(chan struct{})}
+}
+
+func (lc *lifecycle) track(srv *http.Server) {
+	lc.mu.Lock()
+	lc.servers = append(lc.servers, srv)
+	lc.mu.Unlock()
+}
+
+// Shutdown - gracefully stops all servers started with Run/RunS, long lived
+// connections such as SSE streams and websockets are notified to finish first
+func (rtr Router) Shutdown(ctx context.Context) error {
+	if rtr.lifecycle == nil {
+		return nil
+	}
+	lc := rtr.lifecycle
+	lc.once.Do(func() {
+		close(lc.done)
+	})
+	lc.mu.Lock()
+	servers := lc.servers
+	lc.mu.Unlock()
+	var err error
+	for _, srv := range servers {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		rtr.log.Error("SERVER_SHUTDOWN", err)
+	}
+	return err
+}
+
+// ShuttingDown - returns a channel closed when the router serving the request
+// begins shutting down, long running handlers should return when it fires
+func ShuttingDown(r *http.Request) <-chan struct{} {
+	done, _ := r.Context().Value(shutdownKey{}).(chan struct{})
+	return done
+}
+
+func (lc *lifecycle) inject(r *http.Request) *http.Request {
+	if lc == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), shutdownKey{}, lc.done))
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamClosed - returned when sending on a stream that is no longer open
+var ErrStreamClosed = errors.New("stream closed")
+
+// SSEOptions - options for a server-sent events stream
+type SSEOptions struct {
+	// Retry - reconnection delay advertised to the client, not sent when 0
+	Retry time.Duration
+	// Heartbeat - interval of comment lines keeping proxies from closing an idle
+	// stream, defaults to 15s, a negative value disables it
+	Heartbeat time.Duration
+}
+
+// SSEEvent - a single server-sent event, Data is sent as is when it is a string
+// or []byte and json encoded otherwise
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+// SSE - server-sent events stream bound to a request
+type SSE struct {
+	w           http.ResponseWriter
+	flusher     http.Flusher
+	lastEventID string
+	mu          sync.Mutex
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewSSE - starts a server-sent events stream on the response, the stream is done
+// when the client disconnects, the router shuts down or Close is called, which
+// must happen before the handler returns, see ServeSSE
+func NewSSE(w http.ResponseWriter, r *http.Request, opts SSEOptions) (*SSE, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("sse: response writer does not support flushing")
+	}
+	if opts.Heartbeat == 0 {
+		opts.Heartbeat = 15 * time.Second
+	}
+	s := &SSE{
+		w:           w,
+		flusher:     flusher,
+		lastEventID: r.Header.Get("Last-Event-ID"),
+		done:        make(chan struct{}),
+	}
+	// browsers can't set headers on the initial EventSource connection
+	if s.lastEventID == "" {
+		s.lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	hdr := w.Header()
+	hdr.Set("Content-Type", "text/event-stream")
+	hdr.Set("Cache-Control", "no-cache")
+	hdr.Set("Connection", "keep-alive")
+	// disable response buffering on nginx
+	hdr.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if opts.Retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n\n", opts.Retry.Milliseconds())
+	}
+	flusher.Flush()
+
+	go s.watch(r, opts.Heartbeat)
+	return s, nil
+}
+
+// ServeSSE - handler starting a stream for fn and closing it once fn returns,
+// so no heartbeat is written after the response is finished even when fn does
+// not call Close, 500 is sent when the writer does not support flushing
+func ServeSSE(opts SSEOptions, fn func(stream *SSE, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stream, e := NewSSE(w, r, opts)
+		if e != nil {
+			writeError(w, http.StatusInternalServerError, "Streaming unsupported")
+			return
+		}
+		defer stream.Close()
+		fn(stream, r)
+	}
+}
+
+// LastEventID - id of the last event received by a reconnecting client,
+// used to resume the stream where it left off
+func (s *SSE) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done - closed when the stream ends, handlers should return when it fires
+func (s *SSE) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send - writes an event and flushes it to the client
+func (s *SSE) Send(ev SSEEvent) error {
+	var data string
+	switch v := ev.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		b, e := json.Marshal(v)
+		if e != nil {
+			return e
+		}
+		data = string(b)
+	}
+
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + ev.ID + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + ev.Event + "\n")
+	}
+	if ev.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", ev.Retry.Milliseconds())
+	}
+	// multi line payloads need a data field per line
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Close - ends the stream, call it before the handler returns so no heartbeat
+// is written once the response is finished
+func (s *SSE) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+func (s *SSE) closeLocked() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *SSE) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return ErrStreamClosed
+	default:
+	}
+	if _, e := s.w.Write([]byte(msg)); e != nil {
+		s.closeLocked()
+		return e
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *SSE) watch(r *http.Request, heartbeat time.Duration) {
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	shutdown := ShuttingDown(r)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-r.Context().Done():
+			s.Close()
+			return
+		case <-shutdown:
+			s.Close()
+			return
+		case <-tick:
+			s.write(": ping\n\n")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	router.Get("/events", func(w http.ResponseWriter, r *http.Request) {
+		stream, err := NewSSE(w, r, SSEOptions{Retry: time.Second, Heartbeat: -1})
+		if err != nil {
+			t.Errorf("Error creating stream: %v", err)
+			return
+		}
+		defer stream.Close()
+		stream.Send(SSEEvent{ID: "2", Event: "resume", Data: stream.LastEventID()})
+		stream.Send(SSEEvent{ID: "3", Data: map[string]string{"status": "ok"}})
+		stream.Send(SSEEvent{Data: "line1\nline2"})
+		<-stream.Done()
+	})
+	srv := httptest.NewServer(router.Engine)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream content type, got %q", ct)
+	}
+
+	expect := []string{
+		"retry: 1000", "",
+		"id: 2", "event: resume", "data: 1", "",
+		"id: 3", `data: {"status":"ok"}`, "",
+		"data: line1", "data: line2", "",
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for i, line := range expect {
+		if !scanner.Scan() {
+			t.Fatalf("Stream ended early at line %d", i)
+		}
+		if scanner.Text() != line {
+			t.Fatalf("Line %d: expected %q, got %q", i, line, scanner.Text())
+		}
+	}
+
+	// shutting down the router ends the stream
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := router.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "data:") {
+			t.Fatal("Unexpected event after shutdown")
+		}
+	}
+}
+
+func TestSSEWithoutFlusher(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := NewSSE(struct{ http.ResponseWriter }{httptest.NewRecorder()}, req, SSEOptions{}); err == nil {
+		t.Fatal("Expected an error for a writer without flush support")
+	}
+}
+
+// flushRecorder is a response writer safe to write from the heartbeat
+type flushRecorder struct {
+	mu     sync.Mutex
+	header http.Header
+	body   strings.Builder
+}
+
+func (f *flushRecorder) Header() http.Header { return f.header }
+func (f *flushRecorder) WriteHeader(int)     {}
+func (f *flushRecorder) Flush()              {}
+func (f *flushRecorder) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.body.Write(p)
+}
+func (f *flushRecorder) String() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.body.String()
+}
+
+func TestServeSSE(t *testing.T) {
+	pinged := make(chan struct{})
+	h := ServeSSE(SSEOptions{Heartbeat: time.Millisecond}, func(stream *SSE, r *http.Request) {
+		// returns without closing the stream once a heartbeat went out
+		for {
+			select {
+			case <-pinged:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	})
+	w := &flushRecorder{header: http.Header{}}
+	go func() {
+		for !strings.Contains(w.String(), ": ping") {
+			time.Sleep(time.Millisecond)
+		}
+		close(pinged)
+	}()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+	written := w.String()
+	time.Sleep(20 * time.Millisecond)
+	if w.String() != written {
+		t.Fatal("Expected no heartbeat after the handler returned")
+	}
+
+	resp := httptest.NewRecorder()
+	ServeSSE(SSEOptions{}, func(*SSE, *http.Request) {}).ServeHTTP(struct{ http.ResponseWriter }{resp}, httptest.NewRequest("GET", "/", nil))
+	if resp.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500 without flush support, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// StaticOptions - options for serving static files from a fs.FS
+type StaticOptions struct {
+	// Index - file served for directories and as SPA fallback, defaults to index.html
+	Index string
+	// SPA - serve Index for unknown routes so client side routing works
+	SPA bool
+	// Browse - enable directory listing, disabled by default
+	Browse bool
+	// Precompressed - serve sibling .br/.gz files when the client accepts them
+	Precompressed bool
+	// MaxAge - Cache-Control max-age for regular files, no header is set when 0
+	MaxAge time.Duration
+	// HashedMaxAge - Cache-Control max-age for hashed assets, defaults to one year,
+	// a negative value disables the special handling of hashed assets
+	HashedMaxAge time.Duration
+	// HashedAssets - matches file names carrying a content hash, when nil names
+	// with a dot or dash separated segment of 8+ alphanumerics containing a digit
+	// are considered hashed, e.g. app.3f2a1b9c.js or main-BdH7x9kQ.css
+	HashedAssets *regexp.Regexp
+}
+
+// ServeFS - serve static files from any fs.FS such as embed.FS or os.DirFS under urlPath
+func (rtr Router) ServeFS(urlPath string, fsys fs.FS, opts StaticOptions) {
+	serveFS(rtr.Engine, urlPath, fsys, opts)
+}
+
+// ServeFS - serve static files from any fs.FS under the group prefix
+func (g *Group) ServeFS(urlPath string, fsys fs.FS, opts StaticOptions) {
+	serveFS(g.Engine, g.prefix+cleanPrefix(urlPath), fsys, opts)
+}
+
+// StaticHandler - returns the handler used by ServeFS, paths are resolved
+// relative to the root of fsys so any url prefix must be stripped beforehand,
+// e.g. with http.StripPrefix
+func StaticHandler(fsys fs.FS, opts StaticOptions) http.Handler {
+	if opts.Index == "" {
+		opts.Index = "index.html"
+	}
+	if opts.HashedMaxAge == 0 {
+		opts.HashedMaxAge = 365 * 24 * time.Hour
+	}
+	return &staticHandler{fsys: fsys, opts: opts}
+}
+
+type staticHandler struct {
+	fsys fs.FS
+	opts StaticOptions
+}
+
+func serveFS(r chi.Router, urlPath string, fsys fs.FS, opts StaticOptions) {
+	prefix := cleanPrefix(urlPath)
+	handler := StaticHandler(fsys, opts)
+	if prefix != "" {
+		// /assets is redirected to /assets/ so relative links resolve, the
+		// location is relative as mounted routers don't know their full path
+		r.Handle(prefix, http.RedirectHandler(path.Base(prefix)+"/", http.StatusMovedPermanently))
+	}
+	r.Handle(prefix+"/*", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the wildcard holds the path relative to the prefix wherever it is mounted
+		rest := chi.URLParam(req, "*")
+		if req.URL.RawPath != "" {
+			if unescaped, e := url.PathUnescape(rest); e == nil {
+				rest = unescaped
+			}
+		}
+		req2 := new(http.Request)
+		*req2 = *req
+		req2.URL = new(url.URL)
+		*req2.URL = *req.URL
+		req2.URL.Path = "/" + rest
+		req2.URL.RawPath = ""
+		handler.ServeHTTP(w, req2)
+	}))
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	stat, e := fs.Stat(h.fsys, name)
+	if e == nil && stat.IsDir() {
+		if name != "." && !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, path.Base(name)+"/", http.StatusMovedPermanently)
+			return
+		}
+		index := path.Join(name, h.opts.Index)
+		if istat, ie := fs.Stat(h.fsys, index); ie == nil && !istat.IsDir() {
+			h.serveFile(w, r, index, istat)
+			return
+		}
+		if h.opts.Browse {
+			http.FileServer(http.FS(h.fsys)).ServeHTTP(w, r)
+			return
+		}
+		e = fs.ErrNotExist
+	}
+	if e != nil {
+		if errors.Is(e, fs.ErrNotExist) && h.spaFallback(r, name) {
+			if istat, ie := fs.Stat(h.fsys, h.opts.Index); ie == nil {
+				h.serveFile(w, r, h.opts.Index, istat)
+				return
+			}
+		}
+		http.NotFound(w, r)
+		return
+	}
+	h.serveFile(w, r, name, stat)
+}
+
+// spaFallback decides whether an unknown path is a client side route, requests
+// for things that look like files still get a 404
+func (h *staticHandler) spaFallback(r *http.Request, name string) bool {
+	if !h.opts.SPA {
+		return false
+	}
+	return path.Ext(name) == "" || strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, stat fs.FileInfo) {
+	hdr := w.Header()
+	switch {
+	case path.Base(name) == h.opts.Index:
+		// the entry point references hashed assets and must always be revalidated
+		hdr.Set("Cache-Control", "no-cache")
+	case h.opts.HashedMaxAge > 0 && h.isHashed(path.Base(name)):
+		hdr.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(h.opts.HashedMaxAge.Seconds()))+", immutable")
+	case h.opts.MaxAge > 0:
+		hdr.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(h.opts.MaxAge.Seconds())))
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		hdr.Set("Content-Type", ctype)
+	}
+	served := name
+	if h.opts.Precompressed {
+		hdr.Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), []string{"br", "gzip"})
+		ext := map[string]string{"br": ".br", "gzip": ".gz"}[encoding]
+		if ext != "" {
+			if cstat, e := fs.Stat(h.fsys, name+ext); e == nil && !cstat.IsDir() {
+				hdr.Set("Content-Encoding", encoding)
+				served = name + ext
+				stat = cstat
+			}
+		}
+	}
+
+	f, e := h.fsys.Open(served)
+	if e != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		// not every fs.FS returns seekable files, fall back to reading it whole
+		data, e := io.ReadAll(f)
+		if e != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	http.ServeContent(w, r, name, stat.ModTime(), content)
+}
+
+func (h *staticHandler) isHashed(base string) bool {
+	if h.opts.HashedAssets != nil {
+		return h.opts.HashedAssets.MatchString(base)
+	}
+	segments := strings.FieldsFunc(strings.TrimSuffix(base, path.Ext(base)), func(c rune) bool {
+		return c == '.' || c == '-' || c == '_'
+	})
+	// the first segment is the asset name itself
+	for i := 1; i < len(segments); i++ {
+		if isHash(segments[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHash(s string) bool {
+	if len(s) < 8 {
+		return false
+	}
+	digit := false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		default:
+			return false
+		}
+	}
+	return digit
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":           {Data: []byte("<html>index</html>")},
+		"app.3f2a1b9c.js":      {Data: []byte("console.log(1)")},
+		"app.3f2a1b9c.js.br":   {Data: []byte("brotli")},
+		"robots.txt":           {Data: []byte("robots")},
+		"docs/readme.txt":      {Data: []byte("readme")},
+		"nested/index.html":    {Data: []byte("<html>nested</html>")},
+		"nested/component.css": {Data: []byte("css")},
+	}
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	router.ServeFS("/app/*", fsys, StaticOptions{SPA: true, Precompressed: true})
+	router.ServeFS("/plain", fsys, StaticOptions{MaxAge: 60e9})
+	router.Mount("/v2").ServeFS("/files", fsys, StaticOptions{})
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		status   int
+		body     string
+		cache    string
+		encoding string
+	}{
+		{"index", "/app/", "", http.StatusOK, "<html>index</html>", "no-cache", ""},
+		{"hashed asset", "/app/app.3f2a1b9c.js", "", http.StatusOK, "console.log(1)", "public, max-age=31536000, immutable", ""},
+		{"precompressed", "/app/app.3f2a1b9c.js", "br, gzip", http.StatusOK, "brotli", "public, max-age=31536000, immutable", "br"},
+		{"spa fallback", "/app/users/42", "", http.StatusOK, "<html>index</html>", "no-cache", ""},
+		{"missing file", "/app/missing.js", "", http.StatusNotFound, "", "", ""},
+		{"no listing", "/plain/docs/", "", http.StatusNotFound, "", "", ""},
+		{"dir index", "/app/nested/", "", http.StatusOK, "<html>nested</html>", "no-cache", ""},
+		{"dir redirect", "/app/nested", "", http.StatusMovedPermanently, "", "", ""},
+		{"prefix redirect", "/plain", "", http.StatusMovedPermanently, "", "", ""},
+		{"max age", "/plain/robots.txt", "", http.StatusOK, "robots", "public, max-age=60", ""},
+		{"no spa", "/plain/users/42", "", http.StatusNotFound, "", "", ""},
+		{"traversal", "/plain/../server.go", "", http.StatusNotFound, "", "", ""},
+		{"mounted", "/v2/files/robots.txt", "", http.StatusOK, "robots", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			resp := httptest.NewRecorder()
+			router.Engine.ServeHTTP(resp, req)
+			if resp.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, resp.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if resp.Body.String() != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, resp.Body.String())
+			}
+			if got := resp.Header().Get("Cache-Control"); got != tt.cache {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.cache, got)
+			}
+			if got := resp.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", tt.encoding, got)
+			}
+		})
+	}
+}
+
+func TestIsHashed(t *testing.T) {
+	h := &staticHandler{}
+	tests := map[string]bool{
+		"app.3f2a1b9c.js":     true,
+		"main-BdH7x9kQ.css":   true,
+		"jquery.min.js":       false,
+		"foo.component.js":    false,
+		"3f2a1b9c.js":         false,
+		"chunk.abcdefgh1.mjs": true,
+	}
+	for name, expect := range tests {
+		if got := h.isHashed(name); got != expect {
+			t.Errorf("%s: expected %v, got %v", name, expect, got)
+		}
+	}
+}
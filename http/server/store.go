@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore - in-process key value store with expiry, it mirrors the subset of
+// github.com/kelchy/go-lib/redis Client methods used by the middlewares so both
+// can be used interchangeably, data is not shared between instances
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+type memoryItem struct {
+	value   string
+	expires time.Time
+}
+
+// NewMemoryStore - constructor to initialize an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]memoryItem{}}
+}
+
+// Get - returns the value of key, empty if missing or expired
+func (m *MemoryStore) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		return "", nil
+	}
+	return item.value, nil
+}
+
+// Set - stores value under key, a ttl of 0 never expires
+func (m *MemoryStore) Set(ctx context.Context, key string, value string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, value, ttl)
+	return "OK", nil
+}
+
+// Del - removes key, returns the number of keys removed
+func (m *MemoryStore) Del(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); !ok {
+		return 0, nil
+	}
+	delete(m.items, key)
+	return 1, nil
+}
+
+// Lock - acquires a lock on key for ttl, returns false if already locked
+func (m *MemoryStore) Lock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(lockPrefix + key); ok {
+		return false, nil
+	}
+	m.set(lockPrefix+key, "", ttl)
+	return true, nil
+}
+
+// Unlock - releases the lock on key, returns false if it was not locked
+func (m *MemoryStore) Unlock(ctx context.Context, key string) (bool, error) {
+	n, e := m.Del(ctx, lockPrefix+key)
+	return n > 0, e
+}
+
+// same prefix as the redis implementation
+const lockPrefix = "lock_"
+
+func (m *MemoryStore) get(key string) (memoryItem, bool) {
+	item, ok := m.items[key]
+	if ok && !item.expires.IsZero() && time.Now().After(item.expires) {
+		delete(m.items, key)
+		return item, false
+	}
+	return item, ok
+}
+
+func (m *MemoryStore) set(key string, value string, ttl time.Duration) {
+	item := memoryItem{value: value}
+	if ttl > 0 {
+		item.expires = time.Now().Add(ttl)
+	}
+	m.items[key] = item
+	// opportunistic cleanup so abandoned keys don't pile up
+	if len(m.items)%1024 == 0 {
+		now := time.Now()
+		for k, v := range m.items {
+			if !v.expires.IsZero() && now.After(v.expires) {
+				delete(m.items, k)
+			}
+		}
+	}
+}
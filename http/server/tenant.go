@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/kelchy/go-lib/log"
+)
+
+// ErrTenantNotFound - returned by a TenantStore for unknown tenants
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// TenantConfig - per tenant settings
+type TenantConfig struct {
+	ID string
+	// Disabled - requests for disabled tenants get 403
+	Disabled bool
+	// Origins - origins allowed to call on behalf of the tenant, wildcard
+	// subdomains such as https://*.example.com are supported, empty allows all
+	Origins []string
+	// RateLimit - maximum requests per RateWindow, 0 is unlimited
+	RateLimit int
+	// RateWindow - window of RateLimit, defaults to one minute
+	RateWindow time.Duration
+	// Metadata - free form settings for the application
+	Metadata map[string]string
+}
+
+// TenantStore - lookup of tenant configuration, ErrTenantNotFound is expected
+// for unknown tenants
+type TenantStore interface {
+	Tenant(ctx context.Context, id string) (*TenantConfig, error)
+}
+
+// StaticTenantStore - TenantStore backed by a fixed map of tenant id to config
+type StaticTenantStore map[string]TenantConfig
+
+// Tenant - returns the config of tenant id
+func (s StaticTenantStore) Tenant(ctx context.Context, id string) (*TenantConfig, error) {
+	cfg, ok := s[id]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	if cfg.ID == "" {
+		cfg.ID = id
+	}
+	return &cfg, nil
+}
+
+// TenantResolver - extracts the tenant id from a request, empty if not found,
+// resolvers consuming part of the url return the rewritten request to continue with
+type TenantResolver func(r *http.Request) (string, *http.Request)
+
+// TenantOptions - options for the tenant middleware
+type TenantOptions struct {
+	// Resolvers - tried in order until one finds a tenant
+	Resolvers []TenantResolver
+	// Store - validates the tenant and returns its config
+	Store TenantStore
+	// Optional - let requests without a tenant through instead of rejecting them
+	Optional bool
+	// UnknownStatus - status for missing and unknown tenants, defaults to 404,
+	// 403 can be used to avoid revealing which tenants exist
+	UnknownStatus int
+}
+
+type tenantKey struct{}
+
+type logContextKey struct{}
+
+// Tenant - middleware resolving the tenant of the request, validating it against
+// the store and enforcing its origins and rate limit, the config is available to
+// handlers through GetTenant and logged with the tenant access log field, the
+// context of the extended logger is attached for LogContext, a tenant already
+// present in the context (e.g. set by tests) is used as is. Preflights are
+// answered before routing, set CorsOptions.Tenants for the tenant origins to
+// be allowed by them
+func Tenant(opts TenantOptions) Middleware {
+	if opts.UnknownStatus == 0 {
+		opts.UnknownStatus = http.StatusNotFound
+	}
+	limiter := &tenantLimiter{windows: map[string]*rateWindow{}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg := GetTenant(r)
+			if cfg == nil {
+				var id string
+				id, r = opts.resolve(r)
+				if id == "" {
+					if opts.Optional {
+						next.ServeHTTP(w, withLogContext(r))
+						return
+					}
+					writeError(w, opts.UnknownStatus, "Unknown tenant")
+					return
+				}
+				var e error
+				cfg, e = opts.Store.Tenant(r.Context(), id)
+				if errors.Is(e, ErrTenantNotFound) || (e == nil && cfg == nil) {
+					writeError(w, opts.UnknownStatus, "Unknown tenant")
+					return
+				}
+				if e != nil {
+					writeError(w, http.StatusServiceUnavailable, "Tenant store unavailable")
+					return
+				}
+				r = SetTenant(r, cfg)
+			}
+			if cfg.Disabled {
+				writeError(w, http.StatusForbidden, "Tenant is disabled")
+				return
+			}
+			if origin := r.Header.Get("Origin"); origin != "" && len(cfg.Origins) > 0 && !originAllowed(origin, cfg.Origins) {
+				writeError(w, http.StatusForbidden, "Origin not allowed for tenant")
+				return
+			}
+			if wait := limiter.take(cfg); wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds()+0.999)))
+				writeError(w, http.StatusTooManyRequests, "Tenant rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, withLogContext(r))
+		})
+	}
+}
+
+// resolve tries the resolvers in order until one finds a tenant
+func (opts TenantOptions) resolve(r *http.Request) (string, *http.Request) {
+	var id string
+	for _, resolve := range opts.Resolvers {
+		if id, r = resolve(r); id != "" {
+			break
+		}
+	}
+	return id, r
+}
+
+// originAllowed tells whether the tenant of the request allows origin, the
+// request is left untouched so path resolvers don't affect routing
+func (opts TenantOptions) originAllowed(r *http.Request, origin string) bool {
+	if opts.Store == nil {
+		return false
+	}
+	cfg := GetTenant(r)
+	if cfg == nil {
+		id, _ := opts.resolve(r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, nil)))
+		if id == "" {
+			return false
+		}
+		var e error
+		if cfg, e = opts.Store.Tenant(r.Context(), id); e != nil || cfg == nil {
+			return false
+		}
+	}
+	return !cfg.Disabled && len(cfg.Origins) > 0 && originAllowed(origin, cfg.Origins)
+}
+
+// SetTenant - returns a shallow copy of the request carrying the tenant config
+func SetTenant(r *http.Request, cfg *TenantConfig) *http.Request {
+	if info := getRequestInfo(r); info != nil {
+		info.mu.Lock()
+		info.tenant = cfg.ID
+		info.mu.Unlock()
+	}
+	return r.WithContext(context.WithValue(r.Context(), tenantKey{}, cfg))
+}
+
+// GetTenant - returns the tenant config of the request, nil if none
+func GetTenant(r *http.Request) *TenantConfig {
+	cfg, _ := r.Context().Value(tenantKey{}).(*TenantConfig)
+	return cfg
+}
+
+// GetTenantID - returns the tenant id of the request, empty if none
+func GetTenantID(r *http.Request) string {
+	if cfg := GetTenant(r); cfg != nil {
+		return cfg.ID
+	}
+	if info := getRequestInfo(r); info != nil {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		return info.tenant
+	}
+	return ""
+}
+
+// LogContext - returns the context of the request for the extended logger
+// attached by the Tenant middleware, the tenant id, the principal as user id and
+// the request id as trace id, values set later in the chain are filled in
+func LogContext(r *http.Request) log.ContextData {
+	data, _ := r.Context().Value(logContextKey{}).(log.ContextData)
+	if data.TraceID == "" {
+		data.TraceID = requestID(r)
+	}
+	if data.Tenant == "" {
+		data.Tenant = GetTenantID(r)
+	}
+	if data.UserID == "" {
+		data.UserID = GetPrincipal(r)
+	}
+	return data
+}
+
+// withLogContext attaches the log context of the request
+func withLogContext(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), logContextKey{}, LogContext(r)))
+}
+
+// TenantFromHeader - resolves the tenant from a request header such as X-Tenant-ID
+func TenantFromHeader(name string) TenantResolver {
+	return func(r *http.Request) (string, *http.Request) {
+		return strings.TrimSpace(r.Header.Get(name)), r
+	}
+}
+
+// TenantFromSubdomain - resolves the tenant from the label right below baseDomain,
+// e.g. acme for acme.example.com and api.acme.example.com with base domain example.com
+func TenantFromSubdomain(baseDomain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+	return func(r *http.Request) (string, *http.Request) {
+		host := strings.ToLower(r.Host)
+		if h, _, e := net.SplitHostPort(host); e == nil {
+			host = h
+		}
+		if !strings.HasSuffix(host, suffix) {
+			return "", r
+		}
+		sub := strings.TrimSuffix(host, suffix)
+		if i := strings.LastIndex(sub, "."); i >= 0 {
+			sub = sub[i+1:]
+		}
+		return sub, r
+	}
+}
+
+// TenantFromPath - resolves the tenant from the first path segment, the segment
+// is stripped before routing so /acme/orders is served by the /orders route
+func TenantFromPath() TenantResolver {
+	return func(r *http.Request) (string, *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/")
+		id := p
+		rest := ""
+		if i := strings.Index(p, "/"); i >= 0 {
+			id, rest = p[:i], p[i:]
+		}
+		if id == "" {
+			return "", r
+		}
+		if rest == "" {
+			rest = "/"
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = rest
+		u.RawPath = ""
+		r2.URL = &u
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+			rctx.RoutePath = strings.TrimPrefix(rctx.RoutePath, "/"+id)
+			if rctx.RoutePath == "" {
+				rctx.RoutePath = "/"
+			}
+		}
+		return id, r2
+	}
+}
+
+// TenantFromClaim - resolves the tenant from a claim of the bearer token, parse
+// must verify the token signature and return its claims
+func TenantFromClaim(claim string, parse func(token string) (map[string]interface{}, error)) TenantResolver {
+	return func(r *http.Request) (string, *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+			return "", r
+		}
+		claims, e := parse(strings.TrimSpace(auth[7:]))
+		if e != nil {
+			return "", r
+		}
+		id, _ := claims[claim].(string)
+		return id, r
+	}
+}
+
+// originAllowed matches an origin against a list supporting "*" and wildcard
+// subdomain patterns such as https://*.example.com
+func originAllowed(origin string, allowed []string) bool {
+	origin = strings.ToLower(origin)
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if a == "*" || a == origin {
+			return true
+		}
+		if i := strings.Index(a, "*"); i >= 0 {
+			prefix, suffix := a[:i], a[i+1:]
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tenantLimiter is a fixed window rate limiter keyed by tenant
+type tenantLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// take counts a request, returns how long to wait when the limit is exceeded
+func (l *tenantLimiter) take(cfg *TenantConfig) time.Duration {
+	if cfg.RateLimit <= 0 {
+		return 0
+	}
+	window := cfg.RateWindow
+	if window <= 0 {
+		window = time.Minute
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rw := l.windows[cfg.ID]
+	if rw == nil || now.Sub(rw.start) >= window {
+		rw = &rateWindow{start: now}
+		l.windows[cfg.ID] = rw
+	}
+	if rw.count >= cfg.RateLimit {
+		return rw.start.Add(window).Sub(now)
+	}
+	rw.count++
+	return 0
+}
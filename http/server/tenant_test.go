@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/kelchy/go-lib/log"
+)
+
+func TestTenant(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	store := StaticTenantStore{
+		"acme":    {Origins: []string{"https://*.acme.com"}},
+		"globex":  {Disabled: true},
+		"initech": {RateLimit: 1},
+	}
+	claims := func(token string) (map[string]interface{}, error) {
+		if token != "valid" {
+			return nil, errors.New("invalid token")
+		}
+		return map[string]interface{}{"tid": "acme"}, nil
+	}
+	router.Use(Tenant(TenantOptions{
+		Resolvers: []TenantResolver{
+			TenantFromHeader("X-Tenant-ID"),
+			TenantFromClaim("tid", claims),
+			TenantFromSubdomain("example.com"),
+			TenantFromPath(),
+		},
+		Store: store,
+	}))
+	router.Get("/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetTenantID(r)))
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		host   string
+		header map[string]string
+		status int
+		tenant string
+	}{
+		{"header", "/orders", "", map[string]string{"X-Tenant-ID": "acme"}, http.StatusOK, "acme"},
+		{"claim", "/orders", "", map[string]string{"Authorization": "Bearer valid"}, http.StatusOK, "acme"},
+		{"subdomain", "/orders", "acme.example.com:8080", nil, http.StatusOK, "acme"},
+		{"path", "/acme/orders", "", nil, http.StatusOK, "acme"},
+		{"unknown", "/orders", "", map[string]string{"X-Tenant-ID": "umbrella"}, http.StatusNotFound, ""},
+		{"missing", "/", "", nil, http.StatusNotFound, ""},
+		{"disabled", "/orders", "", map[string]string{"X-Tenant-ID": "globex"}, http.StatusForbidden, ""},
+		{"origin allowed", "/orders", "", map[string]string{"X-Tenant-ID": "acme", "Origin": "https://app.acme.com"}, http.StatusOK, "acme"},
+		{"origin denied", "/orders", "", map[string]string{"X-Tenant-ID": "acme", "Origin": "https://evil.com"}, http.StatusForbidden, ""},
+		{"rate limit", "/orders", "", map[string]string{"X-Tenant-ID": "initech"}, http.StatusOK, "initech"},
+		{"rate limited", "/orders", "", map[string]string{"X-Tenant-ID": "initech"}, http.StatusTooManyRequests, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		resp := httptest.NewRecorder()
+		router.Engine.ServeHTTP(resp, req)
+		if resp.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, resp.Code)
+			continue
+		}
+		if tt.tenant != "" && resp.Body.String() != tt.tenant {
+			t.Errorf("%s: expected tenant %q, got %q", tt.name, tt.tenant, resp.Body.String())
+		}
+		if tt.status == http.StatusTooManyRequests && resp.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected Retry-After header", tt.name)
+		}
+	}
+}
+
+func TestTenantOptional(t *testing.T) {
+	storeErr := tenantStoreFunc(func(ctx context.Context, id string) (*TenantConfig, error) {
+		return nil, errors.New("down")
+	})
+	mw := Tenant(TenantOptions{
+		Resolvers: []TenantResolver{TenantFromHeader("X-Tenant-ID")},
+		Store:     storeErr,
+		Optional:  true,
+	})
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetTenantID(r)))
+	}))
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	if resp.Code != http.StatusOK || resp.Body.String() != "" {
+		t.Fatalf("Expected request without tenant to pass, got %d %q", resp.Code, resp.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 on store error, got %d", resp.Code)
+	}
+
+	// a tenant already in the context skips resolution and the store
+	req = SetTenant(httptest.NewRequest("GET", "/", nil), &TenantConfig{ID: "preset"})
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	if resp.Body.String() != "preset" {
+		t.Fatalf("Expected preset tenant, got %q", resp.Body.String())
+	}
+}
+
+type tenantStoreFunc func(ctx context.Context, id string) (*TenantConfig, error)
+
+func (f tenantStoreFunc) Tenant(ctx context.Context, id string) (*TenantConfig, error) {
+	return f(ctx, id)
+}
+
+func TestLogContext(t *testing.T) {
+	h := Tenant(TenantOptions{
+		Resolvers: []TenantResolver{TenantFromHeader("X-Tenant-ID")},
+		Store:     StaticTenantStore{"acme": {}},
+		Optional:  true,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := LogContext(SetPrincipal(r, "user-1"))
+		w.Write([]byte(ctx.TraceID + " " + ctx.Tenant + " " + ctx.UserID))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	if got := resp.Body.String(); got != "req-1 acme user-1" {
+		t.Fatalf("Expected trace, tenant and user in the log context, got %q", got)
+	}
+	// attached by the middleware with the principal of an earlier auth middleware
+	var attached log.ContextData
+	h = Tenant(TenantOptions{
+		Resolvers: []TenantResolver{TenantFromHeader("X-Tenant-ID")},
+		Store:     StaticTenantStore{"acme": {}},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attached, _ = r.Context().Value(logContextKey{}).(log.ContextData)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), SetPrincipal(req, "user-2"))
+	if attached != (log.ContextData{TraceID: "req-1", Tenant: "acme", UserID: "user-2"}) {
+		t.Fatalf("Expected the log context attached by the middleware, got %+v", attached)
+	}
+	if got := LogContext(httptest.NewRequest("GET", "/", nil)); got != (log.ContextData{}) {
+		t.Fatalf("Expected empty log context without tenant, got %+v", got)
+	}
+}
+
+func TestTenantCors(t *testing.T) {
+	tenants := &TenantOptions{
+		Resolvers: []TenantResolver{TenantFromPath()},
+		Store: StaticTenantStore{
+			"acme":   {Origins: []string{"https://*.acme.com"}},
+			"globex": {Origins: []string{"https://globex.com"}, Disabled: true},
+		},
+	}
+	router, err := NewWithCorsOptions(&CorsOptions{Origins: []string{"https://app.example.com"}, Tenants: tenants})
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	router.Use(Tenant(*tenants))
+	router.Get("/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetTenantID(r)))
+	})
+
+	do := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		resp := httptest.NewRecorder()
+		router.Engine.ServeHTTP(resp, req)
+		return resp
+	}
+	if resp := do("OPTIONS", "/acme/orders", "https://app.acme.com"); resp.Header().Get("Access-Control-Allow-Origin") != "https://app.acme.com" {
+		t.Fatalf("Expected preflight allowed by the tenant origins, got %v", resp.Header())
+	}
+	for _, c := range [][2]string{{"/acme/orders", "https://globex.com"}, {"/globex/orders", "https://globex.com"}, {"/initech/orders", "https://app.acme.com"}} {
+		if resp := do("OPTIONS", c[0], c[1]); resp.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s %s: expected preflight to be refused", c[0], c[1])
+		}
+	}
+	if resp := do("OPTIONS", "/acme/orders", "https://app.example.com"); resp.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Fatal("Expected router origins to stay allowed")
+	}
+	// resolving the tenant for CORS leaves routing untouched
+	resp := do("GET", "/acme/orders", "https://app.acme.com")
+	if resp.Code != 200 || resp.Body.String() != "acme" || resp.Header().Get("Access-Control-Allow-Origin") != "https://app.acme.com" {
+		t.Fatalf("Expected tenant route with CORS headers, got %d %s %v", resp.Code, resp.Body.String(), resp.Header())
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	sign := func(key []byte, id string, ts string, body string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(id + "." + ts + "." + body))
+		return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	if _, err := VerifyWebhook(WebhookOptions{}); err == nil {
+		t.Fatal("Expected error without secrets")
+	}
+	verify, err := VerifyWebhook(WebhookOptions{Secrets: []string{"whsec_" + base64.StdEncoding.EncodeToString(key), "old-secret"}, MaxBodySize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	hooks := router.Group("/hooks", verify)
+	hooks.Post("/orders", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	payload := `{"type":"order.paid"}`
+	do := func(id string, ts string, sig string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hooks/orders", strings.NewReader(body))
+		req.Header.Set("webhook-id", id)
+		req.Header.Set("webhook-timestamp", ts)
+		req.Header.Set("webhook-signature", sig)
+		rec := httptest.NewRecorder()
+		router.Engine.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("msg_1", now, sign(key, "msg_1", now, payload), payload); rec.Code != 200 || rec.Body.String() != payload {
+		t.Fatalf("Expected valid signature to pass with the body, got %d %s", rec.Code, rec.Body.String())
+	}
+	// rotated secrets and several signatures
+	if rec := do("msg_2", now, "v1,bm9wZQ== "+sign([]byte("old-secret"), "msg_2", now, payload), payload); rec.Code != 200 {
+		t.Fatalf("Expected signature of the old secret to pass, got %d", rec.Code)
+	}
+
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	cases := []struct {
+		name   string
+		id     string
+		ts     string
+		sig    string
+		body   string
+		status int
+	}{
+		{"tampered", "msg_1", now, sign(key, "msg_1", now, payload), `{"type":"order.refunded"}`, 401},
+		{"other id", "msg_3", now, sign(key, "msg_1", now, payload), payload, 401},
+		{"stale", "msg_1", stale, sign(key, "msg_1", stale, payload), payload, 401},
+		{"missing", "", now, sign(key, "", now, payload), payload, 400},
+		{"bad timestamp", "msg_1", "yesterday", "v1,x", payload, 400},
+		{"other version", "msg_1", now, "v2," + strings.TrimPrefix(sign(key, "msg_1", now, payload), "v1,"), payload, 401},
+		{"too large", "msg_1", now, "v1,x", strings.Repeat("x", 65), 413},
+	}
+	for _, c := range cases {
+		if rec := do(c.id, c.ts, c.sig, c.body); rec.Code != c.status {
+			t.Errorf("%s: expected %d, got %d", c.name, c.status, rec.Code)
+		}
+	}
+}
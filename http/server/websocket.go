@@ -0,0 +1,312 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocket message types re-exported so callers don't need to import gorilla
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+)
+
+// ErrSendBufferFull - returned when a slow client can't keep up, the connection is closed
+var ErrSendBufferFull = errors.New("websocket send buffer full")
+
+// WebSocketOptions - options for the websocket upgrade handler
+type WebSocketOptions struct {
+	// ReadLimit - maximum size of an incoming message in bytes, defaults to 64KB
+	ReadLimit int64
+	// PingInterval - interval of pings sent to the client, defaults to 30s
+	PingInterval time.Duration
+	// PongWait - time allowed to receive a pong before the connection is considered
+	// dead, defaults to twice the PingInterval
+	PongWait time.Duration
+	// WriteWait - time allowed to write a message, defaults to 10s
+	WriteWait time.Duration
+	// SendBuffer - number of queued outgoing messages per connection, defaults to 16
+	SendBuffer int
+	// Subprotocols - supported subprotocols in order of preference
+	Subprotocols []string
+	// CheckOrigin - validates the Origin header, same origin only when nil
+	CheckOrigin func(r *http.Request) bool
+}
+
+// WebSocketHandler - callbacks invoked over the lifetime of a websocket connection
+type WebSocketHandler struct {
+	OnConnect func(c *WebSocketConn)
+	OnMessage func(c *WebSocketConn, messageType int, data []byte)
+	OnClose   func(c *WebSocketConn, err error)
+}
+
+// WebSocketConn - an upgraded websocket connection, safe for concurrent sends
+type WebSocketConn struct {
+	// Request - the request that was upgraded, handy to read auth or url params
+	Request   *http.Request
+	conn      *websocket.Conn
+	send      chan wsMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	hubs      map[*Hub]map[string]struct{}
+}
+
+type wsMessage struct {
+	messageType int
+	data        []byte
+}
+
+// WebSocket - returns a handler upgrading requests to websocket connections, the
+// handler blocks for the lifetime of the connection so the catchall middleware
+// logs it once closed, connections are closed when the router shuts down
+func WebSocket(opts WebSocketOptions, handler WebSocketHandler) http.HandlerFunc {
+	if opts.ReadLimit <= 0 {
+		opts.ReadLimit = 64 * 1024
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = 30 * time.Second
+	}
+	if opts.PongWait <= 0 {
+		opts.PongWait = 2 * opts.PingInterval
+	}
+	if opts.WriteWait <= 0 {
+		opts.WriteWait = 10 * time.Second
+	}
+	if opts.SendBuffer <= 0 {
+		opts.SendBuffer = 16
+	}
+	upgrader := websocket.Upgrader{
+		Subprotocols: opts.Subprotocols,
+		CheckOrigin:  opts.CheckOrigin,
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, e := upgrader.Upgrade(w, r, nil)
+		if e != nil {
+			// the upgrader already replied with an error status
+			return
+		}
+		c := &WebSocketConn{
+			Request: r,
+			conn:    conn,
+			send:    make(chan wsMessage, opts.SendBuffer),
+			done:    make(chan struct{}),
+		}
+		conn.SetReadLimit(opts.ReadLimit)
+		conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+		})
+
+		go c.writePump(&opts, ShuttingDown(r))
+		if handler.OnConnect != nil {
+			handler.OnConnect(c)
+		}
+		err := c.readPump(handler)
+		c.Close()
+		if handler.OnClose != nil {
+			handler.OnClose(c, err)
+		}
+	}
+}
+
+// Send - queues a message for the client, never blocks
+func (c *WebSocketConn) Send(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		return ErrStreamClosed
+	default:
+	}
+	select {
+	case c.send <- wsMessage{messageType: messageType, data: data}:
+		return nil
+	default:
+		c.closeLocked()
+		return ErrSendBufferFull
+	}
+}
+
+// SendJSON - queues a json encoded text message for the client
+func (c *WebSocketConn) SendJSON(v interface{}) error {
+	data, e := json.Marshal(v)
+	if e != nil {
+		return e
+	}
+	return c.Send(TextMessage, data)
+}
+
+// Done - closed once the connection is closed
+func (c *WebSocketConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Subprotocol - the negotiated subprotocol, empty if none
+func (c *WebSocketConn) Subprotocol() string {
+	return c.conn.Subprotocol()
+}
+
+// Close - closes the connection and removes it from all hubs
+func (c *WebSocketConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeLocked()
+}
+
+func (c *WebSocketConn) closeLocked() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		for hub, groups := range c.hubs {
+			for group := range groups {
+				hub.remove(group, c)
+			}
+		}
+		c.hubs = nil
+	})
+}
+
+func (c *WebSocketConn) readPump(handler WebSocketHandler) error {
+	for {
+		messageType, data, e := c.conn.ReadMessage()
+		if e != nil {
+			if websocket.IsCloseError(e, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return e
+		}
+		if handler.OnMessage != nil {
+			handler.OnMessage(c, messageType, data)
+		}
+	}
+}
+
+// writePump owns all writes to the connection as gorilla allows one concurrent writer
+func (c *WebSocketConn) writePump(opts *WebSocketOptions, shutdown <-chan struct{}) {
+	ticker := time.NewTicker(opts.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if e := c.conn.WriteMessage(msg.messageType, msg.data); e != nil {
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if e := c.conn.WriteMessage(websocket.PingMessage, nil); e != nil {
+				c.Close()
+				return
+			}
+		case <-shutdown:
+			c.closeWith(websocket.CloseGoingAway, "server shutting down", opts.WriteWait)
+			c.Close()
+			return
+		case <-c.done:
+			c.closeWith(websocket.CloseNormalClosure, "", opts.WriteWait)
+			return
+		}
+	}
+}
+
+func (c *WebSocketConn) closeWith(code int, reason string, wait time.Duration) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wait))
+}
+
+// Hub - registry of websocket connections organised in named groups for broadcasting
+type Hub struct {
+	mu     sync.RWMutex
+	groups map[string]map[*WebSocketConn]struct{}
+}
+
+// NewHub - constructor to initialize a hub
+func NewHub() *Hub {
+	return &Hub{groups: map[string]map[*WebSocketConn]struct{}{}}
+}
+
+// Join - adds the connection to a group, it leaves automatically once closed
+func (h *Hub) Join(group string, c *WebSocketConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	if c.hubs == nil {
+		c.hubs = map[*Hub]map[string]struct{}{}
+	}
+	if c.hubs[h] == nil {
+		c.hubs[h] = map[string]struct{}{}
+	}
+	c.hubs[h][group] = struct{}{}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.groups[group] == nil {
+		h.groups[group] = map[*WebSocketConn]struct{}{}
+	}
+	h.groups[group][c] = struct{}{}
+}
+
+// Leave - removes the connection from a group
+func (h *Hub) Leave(group string, c *WebSocketConn) {
+	c.mu.Lock()
+	delete(c.hubs[h], group)
+	c.mu.Unlock()
+	h.remove(group, c)
+}
+
+// Broadcast - sends a message to every connection of the group, returns the
+// number of connections the message was queued for
+func (h *Hub) Broadcast(group string, messageType int, data []byte) int {
+	h.mu.RLock()
+	conns := make([]*WebSocketConn, 0, len(h.groups[group]))
+	for c := range h.groups[group] {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+
+	sent := 0
+	for _, c := range conns {
+		if c.Send(messageType, data) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// BroadcastJSON - sends a json encoded text message to every connection of the group
+func (h *Hub) BroadcastJSON(group string, v interface{}) (int, error) {
+	data, e := json.Marshal(v)
+	if e != nil {
+		return 0, e
+	}
+	return h.Broadcast(group, TextMessage, data), nil
+}
+
+// Count - number of connections in a group
+func (h *Hub) Count(group string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.groups[group])
+}
+
+func (h *Hub) remove(group string, c *WebSocketConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.groups[group], c)
+	if len(h.groups[group]) == 0 {
+		delete(h.groups, group)
+	}
+}
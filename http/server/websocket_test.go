@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketHub(t *testing.T) {
+	router, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	router.SetLogger("empty")
+	hub := NewHub()
+	closed := make(chan error, 2)
+	router.Get("/ws", WebSocket(WebSocketOptions{ReadLimit: 16}, WebSocketHandler{
+		OnConnect: func(c *WebSocketConn) {
+			hub.Join("room", c)
+		},
+		OnMessage: func(c *WebSocketConn, messageType int, data []byte) {
+			hub.Broadcast("room", messageType, data)
+		},
+		OnClose: func(c *WebSocketConn, err error) {
+			closed <- err
+		},
+	}))
+	srv := httptest.NewServer(router.Engine)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Error dialing: %v", err)
+		}
+		return conn
+	}
+	a := dial()
+	defer a.Close()
+	b := dial()
+	defer b.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Count("room") != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.Count("room") != 2 {
+		t.Fatalf("Expected 2 connections in room, got %d", hub.Count("room"))
+	}
+
+	if err := a.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range []*websocket.Conn{a, b} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil || string(data) != "hello" {
+			t.Fatalf("Expected broadcast message, got %q %v", data, err)
+		}
+	}
+
+	// messages over the read limit close the connection
+	b.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 32)))
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Fatal("Expected read limit error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Connection not closed after exceeding read limit")
+	}
+	if hub.Count("room") != 1 {
+		t.Fatalf("Expected closed connection to leave the room, got %d", hub.Count("room"))
+	}
+
+	// shutdown sends a going away close frame
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	router.Shutdown(ctx)
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = a.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("Expected going away close, got %v", err)
+	}
+}
@@ -17,6 +17,23 @@ type Client struct {
 	Db         *mongo.Database
 	Connection *mongo.Client
 	log        log.Log
+	// collections - source of the collections of the typed helpers, Db
+	// when nil
+	collections func(colname string) collection
+}
+
+// collection - queries of *mongo.Collection used by the typed helpers
+type collection interface {
+	Find(ctx context.Context, filter interface{}, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...options.Lister[options.AggregateOptions]) (*mongo.Cursor, error)
+}
+
+func (client Client) collection(colname string) collection {
+	if client.collections != nil {
+		return client.collections(colname)
+	}
+	return client.Db.Collection(colname)
 }
 
 // New - constructor to initiate client instance
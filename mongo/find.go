@@ -0,0 +1,261 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrNoDocuments - re-export mongo.ErrNoDocuments, returned by FindOneAs
+var ErrNoDocuments = mongo.ErrNoDocuments
+
+// Collation - re-export options.Collation
+type Collation = options.Collation
+
+// SortField - field of a sort, Order is 1 for ascending and -1 for descending
+type SortField struct {
+	Field string
+	Order int
+}
+
+// Asc - ascending sort on field
+func Asc(field string) SortField {
+	return SortField{Field: field, Order: 1}
+}
+
+// Desc - descending sort on field
+func Desc(field string) SortField {
+	return SortField{Field: field, Order: -1}
+}
+
+// FindOptions - typed options of FindAs, FindOneAs and the iterators, zero
+// values are unset
+type FindOptions struct {
+	Skip  int64
+	Limit int64
+	// Sort - fields in order of precedence
+	Sort []SortField
+	// Projection - fields returned, e.g. bson.M{"name": 1, "_id": 0}
+	Projection interface{}
+	Collation  *Collation
+	// Hint - index name or index key document
+	Hint interface{}
+	// MaxTime - bounds the query with a context deadline
+	MaxTime time.Duration
+	// BatchSize - documents fetched per round trip by iterators
+	BatchSize int32
+}
+
+// merge applies the set fields of o over f
+func (f FindOptions) merge(o FindOptions) FindOptions {
+	if o.Skip != 0 {
+		f.Skip = o.Skip
+	}
+	if o.Limit != 0 {
+		f.Limit = o.Limit
+	}
+	if len(o.Sort) > 0 {
+		f.Sort = o.Sort
+	}
+	if o.Projection != nil {
+		f.Projection = o.Projection
+	}
+	if o.Collation != nil {
+		f.Collation = o.Collation
+	}
+	if o.Hint != nil {
+		f.Hint = o.Hint
+	}
+	if o.MaxTime != 0 {
+		f.MaxTime = o.MaxTime
+	}
+	if o.BatchSize != 0 {
+		f.BatchSize = o.BatchSize
+	}
+	return f
+}
+
+func (f FindOptions) sort() bson.D {
+	sort := bson.D{}
+	for _, s := range f.Sort {
+		sort = append(sort, bson.E{Key: s.Field, Value: s.Order})
+	}
+	return sort
+}
+
+func (f FindOptions) find() *options.FindOptionsBuilder {
+	opts := options.Find()
+	if f.Skip > 0 {
+		opts.SetSkip(f.Skip)
+	}
+	if f.Limit > 0 {
+		opts.SetLimit(f.Limit)
+	}
+	if len(f.Sort) > 0 {
+		opts.SetSort(f.sort())
+	}
+	if f.Projection != nil {
+		opts.SetProjection(f.Projection)
+	}
+	if f.Collation != nil {
+		opts.SetCollation(f.Collation)
+	}
+	if f.Hint != nil {
+		opts.SetHint(f.Hint)
+	}
+	if f.BatchSize > 0 {
+		opts.SetBatchSize(f.BatchSize)
+	}
+	return opts
+}
+
+func (f FindOptions) findOne() *options.FindOneOptionsBuilder {
+	opts := options.FindOne()
+	if f.Skip > 0 {
+		opts.SetSkip(f.Skip)
+	}
+	if len(f.Sort) > 0 {
+		opts.SetSort(f.sort())
+	}
+	if f.Projection != nil {
+		opts.SetProjection(f.Projection)
+	}
+	if f.Collation != nil {
+		opts.SetCollation(f.Collation)
+	}
+	if f.Hint != nil {
+		opts.SetHint(f.Hint)
+	}
+	return opts
+}
+
+// context applies MaxTime to ctx, which can be nil
+func (f FindOptions) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if f.MaxTime <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, f.MaxTime)
+}
+
+func findOptions(opts []FindOptions) FindOptions {
+	var f FindOptions
+	for _, o := range opts {
+		f = f.merge(o)
+	}
+	return f
+}
+
+// filter - nil filters match every document
+func filter(f interface{}) interface{} {
+	if f == nil {
+		return bson.D{}
+	}
+	return f
+}
+
+// FindAs - finds the docs of the collection matching filter and decodes them
+// into T, opts are merged, ctx can be nil
+func FindAs[T any](ctx context.Context, client Client, colname string, filterDoc interface{}, opts ...FindOptions) ([]T, error) {
+	f := findOptions(opts)
+	ctx, cancel := f.context(ctx)
+	defer cancel()
+	docs := []T{}
+	cursor, e := client.collection(colname).Find(ctx, filter(filterDoc), f.find())
+	if e != nil {
+		client.log.Error("MONGO_FIND", e)
+		return docs, e
+	}
+	if e := cursor.All(ctx, &docs); e != nil {
+		client.log.Error("MONGO_CURSOR", e)
+		return docs, e
+	}
+	return docs, nil
+}
+
+// FindOneAs - finds the first doc of the collection matching filter and
+// decodes it into T, ErrNoDocuments when none matches, ctx can be nil
+func FindOneAs[T any](ctx context.Context, client Client, colname string, filterDoc interface{}, opts ...FindOptions) (T, error) {
+	f := findOptions(opts)
+	ctx, cancel := f.context(ctx)
+	defer cancel()
+	var doc T
+	e := client.collection(colname).FindOne(ctx, filter(filterDoc), f.findOne()).Decode(&doc)
+	if e != nil && !errors.Is(e, ErrNoDocuments) {
+		client.log.Error("MONGO_FINDONE", e)
+	}
+	return doc, e
+}
+
+// mapOptions converts the options of the map based API, integers of any
+// type and integral floats are accepted
+func mapOptions(opt map[string]interface{}) (FindOptions, error) {
+	var f FindOptions
+	var e error
+	if v, ok := opt["skip"]; ok && v != nil {
+		if f.Skip, e = toInt64("skip", v); e != nil {
+			return f, e
+		}
+	}
+	if v, ok := opt["limit"]; ok && v != nil {
+		if f.Limit, e = toInt64("limit", v); e != nil {
+			return f, e
+		}
+	}
+	if opt["sort"] != nil && opt["order"] != nil {
+		field, ok := opt["sort"].(string)
+		if !ok {
+			return f, fmt.Errorf("mongo option sort: expected string, got %T", opt["sort"])
+		}
+		order, e := toInt64("order", opt["order"])
+		if e != nil {
+			return f, e
+		}
+		f.Sort = []SortField{{Field: field, Order: int(order)}}
+	}
+	return f, nil
+}
+
+func toInt64(name string, v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int8:
+		return int64(n), nil
+	case int16:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint:
+		return int64(n), nil
+	case uint8:
+		return int64(n), nil
+	case uint16:
+		return int64(n), nil
+	case uint32:
+		return int64(n), nil
+	case uint64:
+		if n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+	case float32:
+		if float32(int64(n)) == n {
+			return int64(n), nil
+		}
+	case float64:
+		if float64(int64(n)) == n {
+			return int64(n), nil
+		}
+	}
+	return 0, fmt.Errorf("mongo option %s: expected an integer, got %T %v", name, v, v)
+}
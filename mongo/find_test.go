@@ -0,0 +1,174 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kelchy/go-lib/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// fakeCollection serves docs from memory and records the queries it gets
+type fakeCollection struct {
+	docs     []interface{}
+	err      error
+	filter   interface{}
+	find     options.FindOptions
+	pipeline interface{}
+	cursor   *mongo.Cursor
+}
+
+func (f *fakeCollection) open(docs []interface{}) (*mongo.Cursor, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	cursor, e := mongo.NewCursorFromDocuments(docs, nil, nil)
+	f.cursor = cursor
+	return cursor, e
+}
+
+func (f *fakeCollection) Find(ctx context.Context, filter interface{}, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+	f.filter = filter
+	f.find = options.FindOptions{}
+	for _, o := range opts {
+		for _, set := range o.List() {
+			set(&f.find)
+		}
+	}
+	docs := f.docs
+	if f.find.Limit != nil && int(*f.find.Limit) < len(docs) {
+		docs = docs[:*f.find.Limit]
+	}
+	return f.open(docs)
+}
+
+func (f *fakeCollection) FindOne(ctx context.Context, filter interface{}, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+	f.filter = filter
+	if len(f.docs) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(f.docs[0], f.err, nil)
+}
+
+func (f *fakeCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...options.Lister[options.AggregateOptions]) (*mongo.Cursor, error) {
+	f.pipeline = pipeline
+	return f.open(f.docs)
+}
+
+func fakeClient(coll *fakeCollection) Client {
+	l, _ := log.New("empty")
+	return Client{log: l, collections: func(string) collection { return coll }}
+}
+
+type user struct {
+	ID   int    `bson:"_id"`
+	Name string `bson:"name"`
+}
+
+func TestMapOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  map[string]interface{}
+		want FindOptions
+		err  bool
+	}{
+		{"empty", nil, FindOptions{}, false},
+		{"int", map[string]interface{}{"skip": 10, "limit": 5}, FindOptions{Skip: 10, Limit: 5}, false},
+		{"int32", map[string]interface{}{"limit": int32(5)}, FindOptions{Limit: 5}, false},
+		{"float64", map[string]interface{}{"limit": float64(5)}, FindOptions{Limit: 5}, false},
+		{"sort", map[string]interface{}{"sort": "start", "order": int64(-1)}, FindOptions{Sort: []SortField{Desc("start")}}, false},
+		{"non integral float", map[string]interface{}{"limit": 5.5}, FindOptions{}, true},
+		{"string", map[string]interface{}{"skip": "10"}, FindOptions{}, true},
+		{"wrong sort", map[string]interface{}{"sort": 1, "order": 1}, FindOptions{}, true},
+		{"wrong order", map[string]interface{}{"sort": "start", "order": "desc"}, FindOptions{}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, e := mapOptions(c.opt)
+			if c.err {
+				if e == nil {
+					t.Fatalf("Expected error, got %+v", got)
+				}
+				return
+			}
+			if e != nil || !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("Expected %+v, got %+v %v", c.want, got, e)
+			}
+		})
+	}
+}
+
+func TestToInt64(t *testing.T) {
+	cases := []struct {
+		v    interface{}
+		want int64
+		err  bool
+	}{
+		{7, 7, false},
+		{int8(-7), -7, false},
+		{int32(7), 7, false},
+		{uint64(7), 7, false},
+		{float32(7), 7, false},
+		{float64(-7), -7, false},
+		{uint64(1 << 63), 0, true},
+		{7.25, 0, true},
+		{"7", 0, true},
+		{nil, 0, true},
+	}
+	for _, c := range cases {
+		got, e := toInt64("limit", c.v)
+		if (e != nil) != c.err || got != c.want {
+			t.Errorf("%T %v: expected %d error %v, got %d %v", c.v, c.v, c.want, c.err, got, e)
+		}
+	}
+}
+
+func TestFindAs(t *testing.T) {
+	coll := &fakeCollection{docs: []interface{}{bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "kim"}}, bson.D{{Key: "_id", Value: 2}, {Key: "name", Value: "lee"}}}}
+	users, e := FindAs[user](context.Background(), fakeClient(coll), "users", nil, FindOptions{Limit: 5, Sort: []SortField{Asc("name")}})
+	if e != nil || !reflect.DeepEqual(users, []user{{1, "kim"}, {2, "lee"}}) {
+		t.Fatalf("Unexpected result %+v %v", users, e)
+	}
+	if !reflect.DeepEqual(coll.filter, bson.D{}) || *coll.find.Limit != 5 || !reflect.DeepEqual(coll.find.Sort, bson.D{{Key: "name", Value: 1}}) {
+		t.Fatalf("Unexpected query %v %+v", coll.filter, coll.find)
+	}
+
+	// no match is an empty slice
+	users, e = FindAs[user](nil, fakeClient(&fakeCollection{}), "users", bson.M{"name": "nobody"})
+	if e != nil || users == nil || len(users) != 0 {
+		t.Fatalf("Expected empty slice, got %#v %v", users, e)
+	}
+
+	// docs not matching T fail to decode
+	coll = &fakeCollection{docs: []interface{}{bson.D{{Key: "_id", Value: "x"}}}}
+	if _, e := FindAs[user](context.Background(), fakeClient(coll), "users", nil); e == nil {
+		t.Fatal("Expected decode error")
+	}
+
+	boom := errors.New("boom")
+	if _, e := FindAs[user](context.Background(), fakeClient(&fakeCollection{err: boom}), "users", nil); !errors.Is(e, boom) {
+		t.Fatalf("Expected find error, got %v", e)
+	}
+}
+
+func TestFindOneAs(t *testing.T) {
+	coll := &fakeCollection{docs: []interface{}{bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "kim"}}}}
+	u, e := FindOneAs[user](context.Background(), fakeClient(coll), "users", bson.M{"_id": 1})
+	if e != nil || u != (user{1, "kim"}) || !reflect.DeepEqual(coll.filter, bson.M{"_id": 1}) {
+		t.Fatalf("Unexpected result %+v %v %v", u, e, coll.filter)
+	}
+
+	u, e = FindOneAs[user](nil, fakeClient(&fakeCollection{}), "users", nil)
+	if !errors.Is(e, ErrNoDocuments) || u != (user{}) {
+		t.Fatalf("Expected ErrNoDocuments and a zero doc, got %+v %v", u, e)
+	}
+
+	coll = &fakeCollection{docs: []interface{}{bson.D{{Key: "name", Value: 7}}}}
+	if _, e := FindOneAs[user](context.Background(), fakeClient(coll), "users", nil); e == nil || errors.Is(e, ErrNoDocuments) {
+		t.Fatalf("Expected decode error, got %v", e)
+	}
+}
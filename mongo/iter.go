@@ -0,0 +1,281 @@
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrStop - returned by the callback of EachFind and EachAggregate to stop
+// the iteration without error
+var ErrStop = errors.New("mongo: stop iteration")
+
+// AggregateOptions - typed options of IterAggregate and EachAggregate
+type AggregateOptions struct {
+	// BatchSize - documents fetched per round trip
+	BatchSize    int32
+	AllowDiskUse bool
+	Collation    *Collation
+	// Hint - index name or index key document
+	Hint interface{}
+	// MaxTime - bounds the aggregation with a context deadline
+	MaxTime time.Duration
+}
+
+// merge applies the set fields of o over a
+func (a AggregateOptions) merge(o AggregateOptions) AggregateOptions {
+	if o.BatchSize != 0 {
+		a.BatchSize = o.BatchSize
+	}
+	if o.AllowDiskUse {
+		a.AllowDiskUse = true
+	}
+	if o.Collation != nil {
+		a.Collation = o.Collation
+	}
+	if o.Hint != nil {
+		a.Hint = o.Hint
+	}
+	if o.MaxTime != 0 {
+		a.MaxTime = o.MaxTime
+	}
+	return a
+}
+
+func aggregateOptions(opts []AggregateOptions) AggregateOptions {
+	var a AggregateOptions
+	for _, o := range opts {
+		a = a.merge(o)
+	}
+	return a
+}
+
+func (a AggregateOptions) aggregate() *options.AggregateOptionsBuilder {
+	opts := options.Aggregate()
+	if a.BatchSize > 0 {
+		opts.SetBatchSize(a.BatchSize)
+	}
+	if a.AllowDiskUse {
+		opts.SetAllowDiskUse(true)
+	}
+	if a.Collation != nil {
+		opts.SetCollation(a.Collation)
+	}
+	if a.Hint != nil {
+		opts.SetHint(a.Hint)
+	}
+	return opts
+}
+
+// IterFind - iterates over the docs of the collection matching filter decoded
+// into T, fetching them in batches instead of loading them all. The query runs
+// when the sequence is ranged over, breaking out of the loop closes the
+// cursor, cursor and context errors end the sequence, ctx can be nil
+func IterFind[T any](ctx context.Context, client Client, colname string, filterDoc interface{}, opts ...FindOptions) iter.Seq2[T, error] {
+	f := findOptions(opts)
+	return cursorSeq[T](client, "MONGO_FIND", func() (context.Context, context.CancelFunc) {
+		return f.context(ctx)
+	}, func(ctx context.Context) (*mongo.Cursor, error) {
+		return client.collection(colname).Find(ctx, filter(filterDoc), f.find())
+	})
+}
+
+// IterAggregate - iterates over the docs produced by the pipeline, opts are
+// merged, see IterFind
+func IterAggregate[T any](ctx context.Context, client Client, colname string, pipeline interface{}, opts ...AggregateOptions) iter.Seq2[T, error] {
+	a := aggregateOptions(opts)
+	return cursorSeq[T](client, "MONGO_AGGREGATE", func() (context.Context, context.CancelFunc) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if a.MaxTime <= 0 {
+			return context.WithCancel(ctx)
+		}
+		return context.WithTimeout(ctx, a.MaxTime)
+	}, func(ctx context.Context) (*mongo.Cursor, error) {
+		return client.collection(colname).Aggregate(ctx, pipeline, a.aggregate())
+	})
+}
+
+// EachFind - calls fn with every doc matching filter, see IterFind, an error
+// of fn stops the iteration and is returned unless it is ErrStop
+func EachFind[T any](ctx context.Context, client Client, colname string, filterDoc interface{}, fn func(T) error, opts ...FindOptions) error {
+	return each(IterFind[T](ctx, client, colname, filterDoc, opts...), fn)
+}
+
+// EachAggregate - calls fn with every doc produced by the pipeline, see EachFind
+func EachAggregate[T any](ctx context.Context, client Client, colname string, pipeline interface{}, fn func(T) error, opts ...AggregateOptions) error {
+	return each(IterAggregate[T](ctx, client, colname, pipeline, opts...), fn)
+}
+
+func each[T any](seq iter.Seq2[T, error], fn func(T) error) error {
+	for doc, e := range seq {
+		if e != nil {
+			return e
+		}
+		if e := fn(doc); e != nil {
+			if errors.Is(e, ErrStop) {
+				return nil
+			}
+			return e
+		}
+	}
+	return nil
+}
+
+// cursorSeq opens the cursor when ranged over and yields its docs, decode
+// errors are yielded without ending the sequence
+func cursorSeq[T any](client Client, scope string, withContext func() (context.Context, context.CancelFunc), open func(context.Context) (*mongo.Cursor, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, cancel := withContext()
+		defer cancel()
+		var zero T
+		cursor, e := open(ctx)
+		if e != nil {
+			client.log.Error(scope, e)
+			yield(zero, e)
+			return
+		}
+		// the cursor is killed on the server when the loop ends early, even
+		// when ctx is done
+		defer cursor.Close(context.Background())
+		for cursor.Next(ctx) {
+			var doc T
+			if e := cursor.Decode(&doc); e != nil {
+				if !yield(zero, e) {
+					return
+				}
+				continue
+			}
+			if !yield(doc, nil) {
+				return
+			}
+		}
+		if e := cursor.Err(); e != nil {
+			client.log.Error(scope+"_CURSOR", e)
+			yield(zero, e)
+		}
+	}
+}
+
+// Page - page of FindPage, Next is the token of the following page, empty on
+// the last one
+type Page[T any] struct {
+	Items []T
+	Next  string
+}
+
+// FindPage - keyset pagination: returns the page of docs after the one the
+// token was returned for, empty for the first page. opts.Sort is the keyset,
+// _id is appended when missing to make it unique and defaults to ascending;
+// opts.Limit is the page size, 100 by default, and Skip is ignored. A
+// projection must include the sort fields. Unlike skip, every page is served
+// by the index of the sort whatever its depth
+func FindPage[T any](ctx context.Context, client Client, colname string, filterDoc interface{}, after string, opts ...FindOptions) (Page[T], error) {
+	f := findOptions(opts)
+	page := Page[T]{Items: []T{}}
+	hasID := false
+	for _, s := range f.Sort {
+		hasID = hasID || s.Field == "_id"
+	}
+	if !hasID {
+		f.Sort = append(append([]SortField(nil), f.Sort...), Asc("_id"))
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	limit := f.Limit
+	// one more tells whether there is a next page
+	f.Limit++
+	f.Skip = 0
+	query := filter(filterDoc)
+	if after != "" {
+		keys, e := decodePageToken(after, len(f.Sort))
+		if e != nil {
+			return page, e
+		}
+		query = bson.D{{Key: "$and", Value: bson.A{query, keysetFilter(f.Sort, keys)}}}
+	}
+	var last bson.Raw
+	for raw, e := range IterFind[bson.Raw](ctx, client, colname, query, f) {
+		if e != nil {
+			return page, e
+		}
+		if int64(len(page.Items)) == limit {
+			token, e := encodePageToken(last, f.Sort)
+			if e != nil {
+				return page, e
+			}
+			page.Next = token
+			break
+		}
+		var doc T
+		if e := bson.Unmarshal(raw, &doc); e != nil {
+			return page, e
+		}
+		page.Items = append(page.Items, doc)
+		last = append(bson.Raw(nil), raw...)
+	}
+	return page, nil
+}
+
+// keysetFilter matches the docs sorted after keys
+func keysetFilter(sort []SortField, keys []bson.RawValue) bson.D {
+	or := bson.A{}
+	for i, s := range sort {
+		cond := bson.D{}
+		for j := 0; j < i; j++ {
+			cond = append(cond, bson.E{Key: sort[j].Field, Value: keys[j]})
+		}
+		op := "$gt"
+		if s.Order < 0 {
+			op = "$lt"
+		}
+		cond = append(cond, bson.E{Key: s.Field, Value: bson.D{{Key: op, Value: keys[i]}}})
+		or = append(or, cond)
+	}
+	return bson.D{{Key: "$or", Value: or}}
+}
+
+type pageToken struct {
+	Keys []bson.RawValue `bson:"k"`
+}
+
+func encodePageToken(doc bson.Raw, sort []SortField) (string, error) {
+	var token pageToken
+	for _, s := range sort {
+		v, e := doc.LookupErr(strings.Split(s.Field, ".")...)
+		if e != nil {
+			return "", fmt.Errorf("mongo keyset field %s missing from document: %w", s.Field, e)
+		}
+		token.Keys = append(token.Keys, v)
+	}
+	data, e := bson.Marshal(token)
+	if e != nil {
+		return "", e
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodePageToken(s string, n int) ([]bson.RawValue, error) {
+	data, e := base64.RawURLEncoding.DecodeString(s)
+	if e != nil {
+		return nil, fmt.Errorf("mongo invalid page token: %w", e)
+	}
+	var token pageToken
+	if e := bson.Unmarshal(data, &token); e != nil {
+		return nil, fmt.Errorf("mongo invalid page token: %w", e)
+	}
+	if len(token.Keys) != n {
+		return nil, errors.New("mongo page token does not match the sort")
+	}
+	return token.Keys, nil
+}
@@ -0,0 +1,214 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestPageToken(t *testing.T) {
+	sort := []SortField{Desc("start"), Asc("meta.name"), Asc("_id")}
+	doc, _ := bson.Marshal(bson.D{{Key: "_id", Value: "a1"}, {Key: "start", Value: int64(42)}, {Key: "meta", Value: bson.D{{Key: "name", Value: "x"}}}})
+	token, e := encodePageToken(doc, sort)
+	if e != nil {
+		t.Fatal(e)
+	}
+	keys, e := decodePageToken(token, len(sort))
+	if e != nil || len(keys) != 3 {
+		t.Fatalf("Expected 3 keys, got %v %v", keys, e)
+	}
+	if keys[0].Int64() != 42 || keys[1].StringValue() != "x" || keys[2].StringValue() != "a1" {
+		t.Fatalf("Expected the sort values of the document, got %v", keys)
+	}
+
+	if _, e := decodePageToken(token, 2); e == nil {
+		t.Fatal("Expected error for a token of another sort")
+	}
+	if _, e := decodePageToken("not base64!", 3); e == nil || !strings.Contains(e.Error(), "invalid page token") {
+		t.Fatalf("Expected invalid page token error, got %v", e)
+	}
+	if _, e := decodePageToken("bm9wZQ", 3); e == nil {
+		t.Fatal("Expected error for a token that is not bson")
+	}
+	if _, e := encodePageToken(doc, []SortField{Asc("end"), Asc("_id")}); e == nil || !strings.Contains(e.Error(), "end") {
+		t.Fatalf("Expected error for a sort field missing from the document, got %v", e)
+	}
+}
+
+func TestKeysetFilter(t *testing.T) {
+	sort := []SortField{Desc("start"), Asc("name"), Asc("_id")}
+	doc, _ := bson.Marshal(bson.D{{Key: "_id", Value: "a1"}, {Key: "start", Value: int64(42)}, {Key: "name", Value: "x"}})
+	token, _ := encodePageToken(doc, sort)
+	keys, _ := decodePageToken(token, len(sort))
+
+	got := keysetFilter(sort, keys)
+	want := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "start", Value: bson.D{{Key: "$lt", Value: keys[0]}}}},
+		bson.D{{Key: "start", Value: keys[0]}, {Key: "name", Value: bson.D{{Key: "$gt", Value: keys[1]}}}},
+		bson.D{{Key: "start", Value: keys[0]}, {Key: "name", Value: keys[1]}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: keys[2]}}}},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected keyset filter\n%v\n%v", got, want)
+	}
+	// the filter is valid bson matching the values of the document
+	raw, e := bson.Marshal(got)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if s := bson.Raw(raw).String(); !strings.Contains(s, `{"start": {"$lt": {"$numberLong":"42"}}}`) || !strings.Contains(s, `"_id": {"$gt": "a1"}`) {
+		t.Fatalf("Unexpected keyset filter bson %s", s)
+	}
+}
+
+func TestAggregateOptions(t *testing.T) {
+	got := aggregateOptions([]AggregateOptions{{BatchSize: 100, Hint: "a_1"}, {AllowDiskUse: true, MaxTime: time.Second}})
+	want := AggregateOptions{BatchSize: 100, Hint: "a_1", AllowDiskUse: true, MaxTime: time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected merged options %+v, got %+v", want, got)
+	}
+}
+
+func userDocs(n int) []interface{} {
+	docs := []interface{}{}
+	for i := 1; i <= n; i++ {
+		docs = append(docs, bson.D{{Key: "_id", Value: i}, {Key: "name", Value: fmt.Sprintf("user%d", i)}})
+	}
+	return docs
+}
+
+func TestIterFind(t *testing.T) {
+	coll := &fakeCollection{docs: userDocs(3)}
+	var names []string
+	for u, e := range IterFind[user](context.Background(), fakeClient(coll), "users", nil, FindOptions{BatchSize: 2}) {
+		if e != nil {
+			t.Fatal(e)
+		}
+		names = append(names, u.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"user1", "user2", "user3"}) || *coll.find.BatchSize != 2 {
+		t.Fatalf("Unexpected iteration %v %+v", names, coll.find)
+	}
+
+	// the query only runs when ranged over, breaking out closes the cursor
+	coll = &fakeCollection{docs: userDocs(3)}
+	seq := IterFind[user](nil, fakeClient(coll), "users", nil)
+	if coll.cursor != nil {
+		t.Fatal("Expected query to be deferred")
+	}
+	for range seq {
+		break
+	}
+	if coll.cursor.Next(context.Background()) {
+		t.Fatal("Expected cursor to be closed after break")
+	}
+
+	// decode errors are yielded and the iteration goes on
+	coll = &fakeCollection{docs: []interface{}{bson.D{{Key: "_id", Value: "x"}}, bson.D{{Key: "_id", Value: 2}}}}
+	var errs, ids int
+	for u, e := range IterFind[user](context.Background(), fakeClient(coll), "users", nil) {
+		if e != nil {
+			errs++
+			continue
+		}
+		ids += u.ID
+	}
+	if errs != 1 || ids != 2 {
+		t.Fatalf("Expected one decode error and the next doc, got %d %d", errs, ids)
+	}
+
+	boom := errors.New("boom")
+	for _, e := range IterFind[user](context.Background(), fakeClient(&fakeCollection{err: boom}), "users", nil) {
+		if !errors.Is(e, boom) {
+			t.Fatalf("Expected find error, got %v", e)
+		}
+	}
+}
+
+func TestEachFind(t *testing.T) {
+	coll := &fakeCollection{docs: userDocs(3)}
+	seen := 0
+	e := EachFind(context.Background(), fakeClient(coll), "users", nil, func(u user) error {
+		seen++
+		if u.ID == 2 {
+			return ErrStop
+		}
+		return nil
+	})
+	if e != nil || seen != 2 || coll.cursor.Next(context.Background()) {
+		t.Fatalf("Expected ErrStop to end the iteration quietly, got %v after %d", e, seen)
+	}
+	boom := errors.New("boom")
+	if e := EachFind(context.Background(), fakeClient(&fakeCollection{docs: userDocs(1)}), "users", nil, func(user) error { return boom }); !errors.Is(e, boom) {
+		t.Fatalf("Expected error of fn, got %v", e)
+	}
+}
+
+func TestIterAggregate(t *testing.T) {
+	coll := &fakeCollection{docs: userDocs(2)}
+	pipeline := bson.A{bson.D{{Key: "$match", Value: bson.D{}}}}
+	total := 0
+	for u, e := range IterAggregate[user](context.Background(), fakeClient(coll), "users", pipeline) {
+		if e != nil {
+			t.Fatal(e)
+		}
+		total += u.ID
+	}
+	if total != 3 || !reflect.DeepEqual(coll.pipeline, pipeline) {
+		t.Fatalf("Unexpected aggregation %d %v", total, coll.pipeline)
+	}
+}
+
+func TestFindPage(t *testing.T) {
+	coll := &fakeCollection{docs: userDocs(3)}
+	page, e := FindPage[user](context.Background(), fakeClient(coll), "users", bson.M{"active": true}, "", FindOptions{Limit: 2, Skip: 5})
+	if e != nil || len(page.Items) != 2 || page.Items[1].ID != 2 || page.Next == "" {
+		t.Fatalf("Expected a full page with a next token, got %+v %v", page, e)
+	}
+	// one more doc than the page size tells there is a next page
+	if *coll.find.Limit != 3 || coll.find.Skip != nil || !reflect.DeepEqual(coll.find.Sort, bson.D{{Key: "_id", Value: 1}}) {
+		t.Fatalf("Unexpected options %+v", coll.find)
+	}
+	if !reflect.DeepEqual(coll.filter, bson.M{"active": true}) {
+		t.Fatalf("Unexpected filter of the first page %v", coll.filter)
+	}
+
+	// the last page has no token
+	coll.docs = userDocs(3)[2:]
+	page, e = FindPage[user](context.Background(), fakeClient(coll), "users", bson.M{"active": true}, page.Next, FindOptions{Limit: 2})
+	if e != nil || len(page.Items) != 1 || page.Items[0].ID != 3 || page.Next != "" {
+		t.Fatalf("Expected last page, got %+v %v", page, e)
+	}
+	keys, _ := decodePageToken(mustToken(t, userDocs(2)[1]), 1)
+	want := bson.D{{Key: "$and", Value: bson.A{bson.M{"active": true}, keysetFilter([]SortField{Asc("_id")}, keys)}}}
+	if !reflect.DeepEqual(coll.filter, want) {
+		t.Fatalf("Expected keyset filter after the token, got %v", coll.filter)
+	}
+
+	// exactly a page of docs left
+	coll.docs = userDocs(2)
+	if page, e = FindPage[user](context.Background(), fakeClient(coll), "users", nil, "", FindOptions{Limit: 2}); e != nil || len(page.Items) != 2 || page.Next != "" {
+		t.Fatalf("Expected no token when the page is exactly full, got %+v %v", page, e)
+	}
+
+	if _, e := FindPage[user](context.Background(), fakeClient(coll), "users", nil, "garbage"); e == nil {
+		t.Fatal("Expected invalid token error")
+	}
+}
+
+func mustToken(t *testing.T, doc interface{}) string {
+	raw, e := bson.Marshal(doc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	token, e := encodePageToken(raw, []SortField{Asc("_id")})
+	if e != nil {
+		t.Fatal(e)
+	}
+	return token
+}
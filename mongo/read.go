@@ -5,7 +5,6 @@ import (
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // Find - function to find doc in collection, ctx can be nil
@@ -14,21 +13,17 @@ func (client Client) Find(ctx context.Context, colname string, filter map[string
 	// select collection
 	col := client.Db.Collection(colname)
 
-	// handle options
-	opts := options.Find()
-	if opt["skip"] != nil {
-		opts.SetSkip(opt["skip"].(int64))
-	}
-	if opt["limit"] != nil {
-		opts.SetLimit(opt["limit"].(int64))
-	}
-	if opt["sort"] != nil && opt["order"] != nil {
-		opts.SetSort(bson.D{{opt["sort"].(string), opt["order"].(int64)}})
-	}
-
 	var e error
 	var docs []bson.M
 
+	// handle options, integers of any type are accepted
+	f, e := mapOptions(opt)
+	if e != nil {
+		client.log.Error("MONGO_FIND", e)
+		return docs, e
+	}
+	opts := f.find()
+
 	// fetch cursor
 	cursor, e := col.Find(ctx, filter, opts)
 	if e != nil {
@@ -52,14 +47,13 @@ func (client Client) FindOne(ctx context.Context, colname string,
 	// select collection
 	col := client.Db.Collection(colname)
 
-	// handle options
-	opts := options.FindOne()
-	if opt["skip"] != nil {
-		opts.SetSkip(opt["skip"].(int64))
-	}
-	if opt["sort"] != nil && opt["order"] != nil {
-		opts.SetSort(bson.D{{opt["sort"].(string), opt["order"].(int64)}})
+	// handle options, integers of any type are accepted
+	f, e := mapOptions(opt)
+	if e != nil {
+		client.log.Error("MONGO_FINDONE", e)
+		return nil, e
 	}
+	opts := f.findOne()
 
 	// fetch doc
 	doc := col.FindOne(ctx, filter, opts)